@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+)
+
+// The persistent cache only holds state fetched from the RPC, never values
+// written by the simulation. Each chain and block gets its own database at
+// <dir>/<chainID>/<blockNumber>-<blockHash>, so a whole block can be inspected
+// or removed without scanning keys. The hash keeps a block that was reorged out
+// from serving state for the block that replaced it at the same height.
+var (
+	balancePrefix = []byte("b")
+	noncePrefix   = []byte("n")
+	codePrefix    = []byte("c")
+	storagePrefix = []byte("s")
+)
+
+var kinds = []struct {
+	name   string
+	prefix []byte
+}{
+	{"balances", balancePrefix},
+	{"nonces", noncePrefix},
+	{"code", codePrefix},
+	{"storage", storagePrefix},
+}
+
+const (
+	cacheSize   = 16
+	fileHandles = 16
+)
+
+func BalanceKey(addr common.Address) []byte {
+	return append(append([]byte{}, balancePrefix...), addr.Bytes()...)
+}
+
+func NonceKey(addr common.Address) []byte {
+	return append(append([]byte{}, noncePrefix...), addr.Bytes()...)
+}
+
+func CodeKey(addr common.Address) []byte {
+	return append(append([]byte{}, codePrefix...), addr.Bytes()...)
+}
+
+func StorageKey(addr common.Address, slot common.Hash) []byte {
+	key := append(append([]byte{}, storagePrefix...), addr.Bytes()...)
+	return append(key, slot.Bytes()...)
+}
+
+// Open opens (creating if needed) the cache database for a chain and block
+func Open(dir string, chainID, blockNum *big.Int, blockHash common.Hash) (ethdb.Database, error) {
+	path := filepath.Join(dir, chainID.String(), fmt.Sprintf("%s-%s", blockNum, blockHash.Hex()))
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	kv, err := leveldb.New(path, cacheSize, fileHandles, "", false)
+	if err != nil {
+		return nil, fmt.Errorf("error opening cache at %s: %w", path, err)
+	}
+
+	return rawdb.NewDatabase(kv), nil
+}
+
+// Inspect writes the number of cached entries of each kind for every chain and
+// block in the cache directory
+func Inspect(dir string, w io.Writer) error {
+	chains, err := listDirs(dir)
+	if err != nil {
+		return err
+	}
+	if len(chains) == 0 {
+		fmt.Fprintf(w, "Cache at %s is empty\n", dir)
+		return nil
+	}
+
+	for _, chainID := range chains {
+		blocks, err := listDirs(filepath.Join(dir, chainID))
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			path := filepath.Join(dir, chainID, block)
+			kv, err := leveldb.New(path, cacheSize, fileHandles, "", true)
+			if err != nil {
+				return fmt.Errorf("error opening cache at %s: %w", path, err)
+			}
+
+			number, hash, _ := strings.Cut(block, "-")
+			fmt.Fprintf(w, "chain %s, block %s (%s):", chainID, number, hash)
+			for _, kind := range kinds {
+				fmt.Fprintf(w, " %s=%d", kind.name, countPrefix(kv, kind.prefix))
+			}
+			fmt.Fprintln(w)
+
+			if err := kv.Close(); err != nil {
+				return fmt.Errorf("error closing cache at %s: %w", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Clear removes the cached state for a single chain, or for every chain when
+// chainID is empty
+func Clear(dir string, chainID string) error {
+	path := dir
+	if chainID != "" {
+		path = filepath.Join(dir, chainID)
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("error clearing cache at %s: %w", path, err)
+	}
+	return nil
+}
+
+func countPrefix(kv ethdb.Iteratee, prefix []byte) int {
+	it := kv.NewIterator(prefix, nil)
+	defer it.Release()
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+	return count
+}
+
+// listDirs returns the sorted sub-directory names of dir, or none if dir does
+// not exist yet
+func listDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache directory %s: %w", dir, err)
+	}
+
+	dirs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+
+	// Directory names start with chain IDs and block numbers, so order them
+	// numerically
+	sort.Slice(dirs, func(i, j int) bool {
+		if len(dirs[i]) != len(dirs[j]) {
+			return len(dirs[i]) < len(dirs[j])
+		}
+		return dirs[i] < dirs[j]
+	})
+	return dirs, nil
+}
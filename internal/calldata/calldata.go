@@ -0,0 +1,279 @@
+package calldata
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackchuma/state-diff/bindings"
+)
+
+// Operation is how a call is made, matching Safe's Enum.Operation
+type Operation uint8
+
+const (
+	OperationCall         Operation = 0
+	OperationDelegateCall Operation = 1
+)
+
+func (o Operation) String() string {
+	switch o {
+	case OperationCall:
+		return "call"
+	case OperationDelegateCall:
+		return "delegatecall"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(o))
+}
+
+// Calls nested deeper than this are not decoded
+var MAX_DEPTH = 16
+
+var SAFE_ABI = `[
+	{"type":"function","name":"execTransaction","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"operation","type":"uint8"},{"name":"safeTxGas","type":"uint256"},{"name":"baseGas","type":"uint256"},{"name":"gasPrice","type":"uint256"},{"name":"gasToken","type":"address"},{"name":"refundReceiver","type":"address"},{"name":"signatures","type":"bytes"}],"outputs":[{"name":"success","type":"bool"}],"stateMutability":"payable"},
+	{"type":"function","name":"approveHash","inputs":[{"name":"hashToApprove","type":"bytes32"}],"outputs":[],"stateMutability":"nonpayable"}
+]`
+
+// MultiSend and MultiSendCallOnly share the same function
+var MULTISEND_ABI = `[
+	{"type":"function","name":"multiSend","inputs":[{"name":"transactions","type":"bytes"}],"outputs":[],"stateMutability":"payable"}
+]`
+
+// Call is a decoded call, along with the calls it makes that could be decoded
+// from its calldata. Function is empty if the calldata isn't a known function.
+type Call struct {
+	Function     string
+	Target       common.Address
+	Operation    Operation
+	Value        *big.Int
+	Data         []byte
+	AllowFailure bool
+	// SafeTx is the transaction passed to execTransaction
+	SafeTx *SafeTx
+	// ApprovedHash is the hash passed to approveHash
+	ApprovedHash *common.Hash
+	// Error is set if the calldata matched a known function but could not be
+	// decoded
+	Error error
+	Calls []*Call
+}
+
+// SafeTx is the Safe transaction executed by execTransaction, without the nonce
+// which the Safe reads from its storage
+type SafeTx struct {
+	To             common.Address
+	Value          *big.Int
+	Data           []byte
+	Operation      Operation
+	SafeTxGas      *big.Int
+	BaseGas        *big.Int
+	GasPrice       *big.Int
+	GasToken       common.Address
+	RefundReceiver common.Address
+	Signatures     []byte
+}
+
+// Selector returns the first four bytes of the calldata, or nil if it is shorter
+func (c *Call) Selector() []byte {
+	if len(c.Data) < 4 {
+		return nil
+	}
+	return c.Data[:4]
+}
+
+type decoder func(call *Call, method *abi.Method, args []any) error
+
+type knownFunction struct {
+	method *abi.Method
+	decode decoder
+}
+
+var knownFunctions map[[4]byte]knownFunction
+
+func init() {
+	knownFunctions = make(map[[4]byte]knownFunction)
+	register := func(abiJSON string, decoders map[string]decoder) {
+		parsed, err := abi.JSON(strings.NewReader(abiJSON))
+		if err != nil {
+			panic(fmt.Sprintf("failed to parse ABI: %v", err))
+		}
+		for name, decode := range decoders {
+			method := parsed.Methods[name]
+			knownFunctions[[4]byte(method.ID)] = knownFunction{&method, decode}
+		}
+	}
+
+	register(SAFE_ABI, map[string]decoder{
+		"execTransaction": decodeExecTransaction,
+		"approveHash":     decodeApproveHash,
+	})
+	register(MULTISEND_ABI, map[string]decoder{
+		"multiSend": decodeMultiSend,
+	})
+	register(bindings.Multicall3ABI, map[string]decoder{
+		"aggregate":            decodeAggregate,
+		"tryAggregate":         decodeAggregate,
+		"blockAndAggregate":    decodeAggregate,
+		"tryBlockAndAggregate": decodeAggregate,
+		"aggregate3":           decodeAggregate3,
+		"aggregate3Value":      decodeAggregate3Value,
+	})
+}
+
+// Decode decodes a call to target and, recursively, the calls encoded in its
+// calldata
+func Decode(target common.Address, value *big.Int, data []byte) *Call {
+	call := &Call{
+		Target:    target,
+		Operation: OperationCall,
+		Value:     value,
+		Data:      data,
+	}
+	decodeCall(call, 0)
+	return call
+}
+
+func decodeCall(call *Call, depth int) {
+	if depth >= MAX_DEPTH || len(call.Data) < 4 {
+		return
+	}
+
+	known, ok := knownFunctions[[4]byte(call.Data[:4])]
+	if !ok {
+		return
+	}
+	call.Function = known.method.Name
+
+	args, err := known.method.Inputs.Unpack(call.Data[4:])
+	if err != nil {
+		call.Error = fmt.Errorf("failed to unpack %s arguments: %w", known.method.Name, err)
+		return
+	}
+	if err := known.decode(call, known.method, args); err != nil {
+		call.Error = err
+		return
+	}
+
+	for _, inner := range call.Calls {
+		decodeCall(inner, depth+1)
+	}
+}
+
+func decodeExecTransaction(call *Call, method *abi.Method, args []any) error {
+	call.SafeTx = &SafeTx{
+		To:             args[0].(common.Address),
+		Value:          args[1].(*big.Int),
+		Data:           args[2].([]byte),
+		Operation:      Operation(args[3].(uint8)),
+		SafeTxGas:      args[4].(*big.Int),
+		BaseGas:        args[5].(*big.Int),
+		GasPrice:       args[6].(*big.Int),
+		GasToken:       args[7].(common.Address),
+		RefundReceiver: args[8].(common.Address),
+		Signatures:     args[9].([]byte),
+	}
+	call.Calls = []*Call{{
+		Target:    call.SafeTx.To,
+		Value:     call.SafeTx.Value,
+		Data:      call.SafeTx.Data,
+		Operation: call.SafeTx.Operation,
+	}}
+	return nil
+}
+
+func decodeApproveHash(call *Call, method *abi.Method, args []any) error {
+	hash := common.Hash(args[0].([32]byte))
+	call.ApprovedHash = &hash
+	return nil
+}
+
+// decodeMultiSend decodes the packed transactions of MultiSend, each encoded as
+// operation (uint8), to (address), value (uint256), data length (uint256) and
+// data
+func decodeMultiSend(call *Call, method *abi.Method, args []any) error {
+	transactions := args[0].([]byte)
+	for i := 0; len(transactions) > 0; i++ {
+		if len(transactions) < 85 {
+			return fmt.Errorf("multiSend transaction %d is truncated", i)
+		}
+		dataLength := new(big.Int).SetBytes(transactions[53:85])
+		if !dataLength.IsUint64() || dataLength.Uint64() > uint64(len(transactions)-85) {
+			return fmt.Errorf("multiSend transaction %d has data length %s beyond the end of the input", i, dataLength)
+		}
+		end := 85 + int(dataLength.Uint64())
+
+		call.Calls = append(call.Calls, &Call{
+			Operation: Operation(transactions[0]),
+			Target:    common.BytesToAddress(transactions[1:21]),
+			Value:     new(big.Int).SetBytes(transactions[21:53]),
+			Data:      common.CopyBytes(transactions[85:end]),
+		})
+		transactions = transactions[end:]
+	}
+	return nil
+}
+
+func decodeAggregate(call *Call, method *abi.Method, args []any) error {
+	// tryAggregate and tryBlockAndAggregate take requireSuccess first
+	calls := args[len(args)-1]
+	for _, inner := range *abi.ConvertType(calls, new([]bindings.Multicall3Call)).(*[]bindings.Multicall3Call) {
+		call.Calls = append(call.Calls, &Call{
+			Target: inner.Target,
+			Data:   inner.CallData,
+		})
+	}
+	return nil
+}
+
+func decodeAggregate3(call *Call, method *abi.Method, args []any) error {
+	for _, inner := range *abi.ConvertType(args[0], new([]bindings.Multicall3Call3)).(*[]bindings.Multicall3Call3) {
+		call.Calls = append(call.Calls, &Call{
+			Target:       inner.Target,
+			Data:         inner.CallData,
+			AllowFailure: inner.AllowFailure,
+		})
+	}
+	return nil
+}
+
+func decodeAggregate3Value(call *Call, method *abi.Method, args []any) error {
+	for _, inner := range *abi.ConvertType(args[0], new([]bindings.Multicall3Call3Value)).(*[]bindings.Multicall3Call3Value) {
+		call.Calls = append(call.Calls, &Call{
+			Target:       inner.Target,
+			Value:        inner.Value,
+			Data:         inner.CallData,
+			AllowFailure: inner.AllowFailure,
+		})
+	}
+	return nil
+}
+
+// TargetSafe returns the Safe whose signers approve the call: the outermost
+// Safe that executes a transaction, or else the outermost Safe a hash is
+// approved on. It returns false if the call tree contains neither.
+func TargetSafe(call *Call) (common.Address, bool) {
+	if found := Find(call, "execTransaction"); found != nil {
+		return found.Target, true
+	}
+	if found := Find(call, "approveHash"); found != nil {
+		return found.Target, true
+	}
+	return common.Address{}, false
+}
+
+// Find returns the first decoded call to function in the call tree, breadth
+// first so that the outermost call is found, or nil if there is none
+func Find(call *Call, function string) *Call {
+	queue := []*Call{call}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current.Function == function && current.Error == nil {
+			return current
+		}
+		queue = append(queue, current.Calls...)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package calldata
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	safeA = common.HexToAddress("0x000000000000000000000000000000000000000a")
+	safeB = common.HexToAddress("0x000000000000000000000000000000000000000b")
+	hashA = common.HexToHash("0xaa")
+	hashB = common.HexToHash("0xbb")
+)
+
+func pack(t *testing.T, abiJSON, name string, args ...any) []byte {
+	t.Helper()
+
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parsed.Pack(name, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// multiSendTx packs a transaction in the encoding of MultiSend: operation,
+// target, value, data length and data
+func multiSendTx(operation Operation, target common.Address, value int64, data []byte) []byte {
+	encoded := []byte{byte(operation)}
+	encoded = append(encoded, target.Bytes()...)
+	encoded = append(encoded, common.BigToHash(big.NewInt(value)).Bytes()...)
+	encoded = append(encoded, common.BigToHash(big.NewInt(int64(len(data)))).Bytes()...)
+	return append(encoded, data...)
+}
+
+func TestDecodeMultiSend(t *testing.T) {
+	approveA := pack(t, SAFE_ABI, "approveHash", hashA)
+	valid := append(multiSendTx(OperationCall, safeA, 0, approveA), multiSendTx(OperationDelegateCall, safeB, 5, nil)...)
+
+	overlong := multiSendTx(OperationCall, safeA, 0, approveA)
+	copy(overlong[53:85], common.BigToHash(big.NewInt(int64(len(approveA)+1))).Bytes())
+
+	huge := multiSendTx(OperationCall, safeA, 0, nil)
+	copy(huge[53:85], common.MaxHash.Bytes())
+
+	tests := []struct {
+		name         string
+		transactions []byte
+		calls        int
+		err          string
+	}{
+		{name: "valid", transactions: valid, calls: 2},
+		{name: "empty", transactions: nil, calls: 0},
+		{name: "truncated header", transactions: valid[:84], err: "multiSend transaction 0 is truncated"},
+		{name: "truncated second transaction", transactions: valid[:len(valid)-1], err: "multiSend transaction 1 is truncated"},
+		{name: "data length beyond the input", transactions: overlong, err: "multiSend transaction 0 has data length"},
+		{name: "data length beyond uint64", transactions: huge, err: "multiSend transaction 0 has data length"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			call := Decode(safeA, big.NewInt(0), pack(t, MULTISEND_ABI, "multiSend", test.transactions))
+			if call.Function != "multiSend" {
+				t.Fatalf("function = %q, want multiSend", call.Function)
+			}
+
+			if test.err != "" {
+				if call.Error == nil || !strings.Contains(call.Error.Error(), test.err) {
+					t.Fatalf("error = %v, want %q", call.Error, test.err)
+				}
+				return
+			}
+			if call.Error != nil {
+				t.Fatalf("unexpected error: %v", call.Error)
+			}
+			if len(call.Calls) != test.calls {
+				t.Fatalf("got %d calls, want %d", len(call.Calls), test.calls)
+			}
+		})
+	}
+}
+
+func TestDecodeMultiSendTransactions(t *testing.T) {
+	approveA := pack(t, SAFE_ABI, "approveHash", hashA)
+	transactions := append(multiSendTx(OperationCall, safeA, 0, approveA), multiSendTx(OperationDelegateCall, safeB, 5, nil)...)
+
+	call := Decode(safeA, big.NewInt(0), pack(t, MULTISEND_ABI, "multiSend", transactions))
+	if call.Error != nil || len(call.Calls) != 2 {
+		t.Fatalf("got %d calls and error %v, want 2 calls", len(call.Calls), call.Error)
+	}
+
+	first, second := call.Calls[0], call.Calls[1]
+	if first.Target != safeA || first.Operation != OperationCall || first.Function != "approveHash" || *first.ApprovedHash != hashA {
+		t.Errorf("first call decoded as %s %s %s", first.Operation, first.Target.Hex(), first.Function)
+	}
+	if second.Target != safeB || second.Operation != OperationDelegateCall || second.Value.Int64() != 5 || len(second.Data) != 0 {
+		t.Errorf("second call decoded as %s %s with value %s", second.Operation, second.Target.Hex(), second.Value)
+	}
+}
+
+func TestFind(t *testing.T) {
+	approve := func(target common.Address, hash common.Hash) *Call {
+		return &Call{Function: "approveHash", Target: target, ApprovedHash: &hash}
+	}
+	failed := approve(safeA, hashA)
+	failed.Error = errors.New("failed to decode")
+
+	tests := []struct {
+		name  string
+		root  *Call
+		found *common.Address
+	}{
+		{
+			name:  "root",
+			root:  approve(safeA, hashA),
+			found: &safeA,
+		},
+		{
+			name: "shallowest before first",
+			root: &Call{Calls: []*Call{
+				{Function: "multiSend", Calls: []*Call{approve(safeA, hashA)}},
+				approve(safeB, hashB),
+			}},
+			found: &safeB,
+		},
+		{
+			name: "first at the same depth",
+			root: &Call{Calls: []*Call{
+				{Calls: []*Call{approve(safeA, hashA)}},
+				{Calls: []*Call{approve(safeB, hashB)}},
+			}},
+			found: &safeA,
+		},
+		{
+			name: "skips calls that failed to decode",
+			root: &Call{Calls: []*Call{
+				failed,
+				{Calls: []*Call{approve(safeB, hashB)}},
+			}},
+			found: &safeB,
+		},
+		{
+			name: "not found",
+			root: &Call{Calls: []*Call{{Function: "multiSend"}, failed}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			call := Find(test.root, "approveHash")
+			if test.found == nil {
+				if call != nil {
+					t.Fatalf("found a call to %s, want none", call.Target.Hex())
+				}
+				return
+			}
+			if call == nil {
+				t.Fatalf("found no call, want one to %s", test.found.Hex())
+			}
+			if call.Target != *test.found {
+				t.Errorf("found a call to %s, want %s", call.Target.Hex(), test.found.Hex())
+			}
+		})
+	}
+}
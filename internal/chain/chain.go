@@ -2,7 +2,9 @@ package chain
 
 import (
 	"context"
+	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
@@ -10,15 +12,27 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/jackchuma/state-diff/internal/fixture"
 )
 
+// HeaderSource provides the headers of past blocks
+type HeaderSource interface {
+	Header(number uint64) (*types.Header, error)
+}
+
 type chainContext struct {
-	config *params.ChainConfig
-	client *ethclient.Client
+	config   *params.ChainConfig
+	headers  HeaderSource
+	recorder *fixture.Bundle
+	onError  func(error)
 }
 
-func NewChainContext(config *params.ChainConfig, client *ethclient.Client) core.ChainContext {
-	return &chainContext{config: config, client: client}
+// NewChainContext creates the chain context used to look up block headers for
+// BLOCKHASH. Headers are recorded into recorder when it is set, and headers
+// that can't be fetched are reported to onError.
+func NewChainContext(config *params.ChainConfig, headers HeaderSource, recorder *fixture.Bundle, onError func(error)) core.ChainContext {
+	return &chainContext{config: config, headers: headers, recorder: recorder, onError: onError}
 }
 
 func (c *chainContext) Config() *params.ChainConfig {
@@ -30,9 +44,42 @@ func (c *chainContext) Engine() consensus.Engine {
 }
 
 func (c *chainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
-	header, err := c.client.HeaderByNumber(context.Background(), big.NewInt(int64(number)))
+	header, err := c.headers.Header(number)
 	if err != nil {
+		if c.onError != nil {
+			c.onError(fmt.Errorf("failed to fetch header of block %d: %w", number, err))
+		}
 		return nil
 	}
+
+	if c.recorder != nil {
+		c.recorder.RecordHeader(header)
+	}
 	return header
 }
+
+// FetchHeader resolves a block selector to a header. The selector can be a
+// block number (decimal or 0x-prefixed hex), a 32-byte block hash, or one of
+// the tags latest, safe or finalized. An empty selector means latest.
+func FetchHeader(client *ethclient.Client, block string) (*types.Header, error) {
+	ctx := context.Background()
+
+	switch block {
+	case "", "latest":
+		return client.HeaderByNumber(ctx, nil)
+	case "safe":
+		return client.HeaderByNumber(ctx, big.NewInt(int64(rpc.SafeBlockNumber)))
+	case "finalized":
+		return client.HeaderByNumber(ctx, big.NewInt(int64(rpc.FinalizedBlockNumber)))
+	}
+
+	if strings.HasPrefix(block, "0x") && len(block) == 66 {
+		return client.HeaderByHash(ctx, common.HexToHash(block))
+	}
+
+	number, ok := new(big.Int).SetString(block, 0)
+	if !ok || number.Sign() < 0 {
+		return nil, fmt.Errorf("invalid block '%s': expected a number, a block hash, latest, safe or finalized", block)
+	}
+	return client.HeaderByNumber(ctx, number)
+}
@@ -0,0 +1,240 @@
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// OPStackForks holds the activation timestamps of the OP Stack hardforks that
+// change EVM execution. Canyon, Ecotone and Isthmus activate Shanghai, Cancun
+// and Prague respectively, which the L1 fields of the chain config already
+// cover. The others only add or limit precompiles.
+type OPStackForks struct {
+	CanyonTime   *uint64 `json:"canyonTime,omitempty"`
+	EcotoneTime  *uint64 `json:"ecotoneTime,omitempty"`
+	FjordTime    *uint64 `json:"fjordTime,omitempty"`
+	GraniteTime  *uint64 `json:"graniteTime,omitempty"`
+	HoloceneTime *uint64 `json:"holoceneTime,omitempty"`
+	IsthmusTime  *uint64 `json:"isthmusTime,omitempty"`
+}
+
+func (f *OPStackForks) IsFjord(time uint64) bool   { return isActive(f.FjordTime, time) }
+func (f *OPStackForks) IsGranite(time uint64) bool { return isActive(f.GraniteTime, time) }
+func (f *OPStackForks) IsIsthmus(time uint64) bool { return isActive(f.IsthmusTime, time) }
+
+func isActive(forkTime *uint64, time uint64) bool {
+	return forkTime != nil && *forkTime <= time
+}
+
+// ChainSpec is everything needed to execute transactions of a chain
+type ChainSpec struct {
+	Name   string
+	Config *params.ChainConfig
+	// OPStack is nil for chains that are not OP Stack chains
+	OPStack *OPStackForks
+}
+
+// Precompiles returns the precompiled contracts active at the given rules and
+// block time, including the OP Stack additions
+func (s *ChainSpec) Precompiles(rules params.Rules, time uint64) vm.PrecompiledContracts {
+	precompiles := vm.ActivePrecompiledContracts(rules)
+	if s.OPStack == nil {
+		return precompiles
+	}
+
+	if s.OPStack.IsFjord(time) {
+		precompiles[P256_VERIFY_ADDRESS] = &p256Verify{}
+	}
+	if s.OPStack.IsGranite(time) {
+		limitInput(precompiles, common.BytesToAddress([]byte{0x08}), BN256_PAIRING_MAX_INPUT_SIZE_GRANITE)
+	}
+	if s.OPStack.IsIsthmus(time) {
+		limitInput(precompiles, common.BytesToAddress([]byte{0x0c}), BLS12381_G1_MSM_MAX_INPUT_SIZE_ISTHMUS)
+		limitInput(precompiles, common.BytesToAddress([]byte{0x0e}), BLS12381_G2_MSM_MAX_INPUT_SIZE_ISTHMUS)
+		limitInput(precompiles, common.BytesToAddress([]byte{0x0f}), BLS12381_PAIRING_MAX_INPUT_SIZE_ISTHMUS)
+	}
+	return precompiles
+}
+
+// ActivePrecompiles returns the sorted addresses of the precompiles active at
+// the given rules and block time
+func (s *ChainSpec) ActivePrecompiles(rules params.Rules, time uint64) []common.Address {
+	precompiles := s.Precompiles(rules, time)
+	addresses := make([]common.Address, 0, len(precompiles))
+	for addr := range precompiles {
+		addresses = append(addresses, addr)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].Cmp(addresses[j]) < 0
+	})
+	return addresses
+}
+
+func u64(v uint64) *uint64 {
+	return &v
+}
+
+// opStackConfig builds the chain config of an OP Stack chain. Every L1 fork up
+// to the merge is active from bedrockBlock, and the timestamp forks follow the
+// OP Stack hardforks they are bundled with.
+func opStackConfig(chainID int64, bedrockBlock int64, forks *OPStackForks) *params.ChainConfig {
+	bedrock := big.NewInt(bedrockBlock)
+	return &params.ChainConfig{
+		ChainID:                 big.NewInt(chainID),
+		HomesteadBlock:          big.NewInt(0),
+		EIP150Block:             big.NewInt(0),
+		EIP155Block:             big.NewInt(0),
+		EIP158Block:             big.NewInt(0),
+		ByzantiumBlock:          big.NewInt(0),
+		ConstantinopleBlock:     big.NewInt(0),
+		PetersburgBlock:         big.NewInt(0),
+		IstanbulBlock:           big.NewInt(0),
+		MuirGlacierBlock:        big.NewInt(0),
+		BerlinBlock:             big.NewInt(0),
+		LondonBlock:             bedrock,
+		ArrowGlacierBlock:       bedrock,
+		GrayGlacierBlock:        bedrock,
+		MergeNetsplitBlock:      bedrock,
+		TerminalTotalDifficulty: big.NewInt(0),
+		ShanghaiTime:            forks.CanyonTime,
+		CancunTime:              forks.EcotoneTime,
+		PragueTime:              forks.IsthmusTime,
+		BlobScheduleConfig: &params.BlobScheduleConfig{
+			Cancun: params.DefaultCancunBlobConfig,
+			Prague: params.DefaultPragueBlobConfig,
+		},
+	}
+}
+
+// Hardfork activation times from the superchain registry. Chains on the
+// Sepolia superchain share their activation times.
+var (
+	opMainnetForks = &OPStackForks{
+		CanyonTime:   u64(1704992401),
+		EcotoneTime:  u64(1710374401),
+		FjordTime:    u64(1720627201),
+		GraniteTime:  u64(1726070401),
+		HoloceneTime: u64(1736445601),
+		IsthmusTime:  u64(1746806401),
+	}
+	opSepoliaForks = &OPStackForks{
+		CanyonTime:   u64(1699981200),
+		EcotoneTime:  u64(1708534800),
+		FjordTime:    u64(1716998400),
+		GraniteTime:  u64(1723478400),
+		HoloceneTime: u64(1732633200),
+		IsthmusTime:  u64(1744905600),
+	}
+)
+
+var registry = map[uint64]*ChainSpec{
+	1:        {Name: "Ethereum Mainnet", Config: params.MainnetChainConfig},
+	11155111: {Name: "Sepolia", Config: params.SepoliaChainConfig},
+	17000:    {Name: "Holesky", Config: params.HoleskyChainConfig},
+	10:       {Name: "OP Mainnet", Config: opStackConfig(10, 105235063, opMainnetForks), OPStack: opMainnetForks},
+	11155420: {Name: "OP Sepolia", Config: opStackConfig(11155420, 0, opSepoliaForks), OPStack: opSepoliaForks},
+	8453:     {Name: "Base", Config: opStackConfig(8453, 0, opMainnetForks), OPStack: opMainnetForks},
+	84532:    {Name: "Base Sepolia", Config: opStackConfig(84532, 0, opSepoliaForks), OPStack: opSepoliaForks},
+}
+
+// Lookup returns the chain spec registered for a chain ID
+func Lookup(chainID *big.Int) (*ChainSpec, error) {
+	if chainID == nil || !chainID.IsUint64() {
+		return nil, fmt.Errorf("unsupported chain ID: %v", chainID)
+	}
+	spec, ok := registry[chainID.Uint64()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported chain ID: %d (use --chain-config to load its chain config)", chainID.Uint64())
+	}
+	return spec, nil
+}
+
+// Register adds a chain spec to the registry, replacing any built-in spec for
+// the same chain ID
+func Register(spec *ChainSpec) {
+	registry[spec.Config.ChainID.Uint64()] = spec
+}
+
+// ActivePrecompiles returns the precompile addresses active for the chain at
+// the given rules and block time, falling back to the L1 precompiles for
+// chains that aren't registered
+func ActivePrecompiles(config *params.ChainConfig, rules params.Rules, time uint64) []common.Address {
+	spec, err := Lookup(config.ChainID)
+	if err != nil {
+		return vm.ActivePrecompiles(rules)
+	}
+	return spec.ActivePrecompiles(rules, time)
+}
+
+// LoadChainConfig reads a chain config from a genesis JSON file, or from a
+// file holding just the "config" object. OP Stack chains are detected by an
+// "optimism" section or any OP Stack hardfork time, as written by op-geth.
+func LoadChainConfig(path string) (*ChainSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading chain config: %w", err)
+	}
+
+	var genesis struct {
+		Config json.RawMessage `json:"config"`
+	}
+	if err := json.Unmarshal(data, &genesis); err != nil {
+		return nil, fmt.Errorf("error parsing chain config: %w", err)
+	}
+	if genesis.Config != nil {
+		data = genesis.Config
+	}
+
+	config := new(params.ChainConfig)
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing chain config: %w", err)
+	}
+	if config.ChainID == nil {
+		return nil, fmt.Errorf("chain config %s has no chainId", path)
+	}
+
+	var opStack struct {
+		OPStackForks
+		Optimism json.RawMessage `json:"optimism"`
+	}
+	if err := json.Unmarshal(data, &opStack); err != nil {
+		return nil, fmt.Errorf("error parsing chain config: %w", err)
+	}
+
+	spec := &ChainSpec{Name: fmt.Sprintf("Chain %s", config.ChainID), Config: config}
+	forks := opStack.OPStackForks
+	if opStack.Optimism != nil || forks != (OPStackForks{}) {
+		spec.OPStack = &forks
+
+		// op-geth configs set both, but fill in the L1 forks if only the OP
+		// Stack ones are given
+		if config.ShanghaiTime == nil {
+			config.ShanghaiTime = forks.CanyonTime
+		}
+		if config.CancunTime == nil {
+			config.CancunTime = forks.EcotoneTime
+		}
+		if config.PragueTime == nil {
+			config.PragueTime = forks.IsthmusTime
+		}
+	}
+
+	if config.BlobScheduleConfig == nil && config.CancunTime != nil {
+		config.BlobScheduleConfig = &params.BlobScheduleConfig{
+			Cancun: params.DefaultCancunBlobConfig,
+			Prague: params.DefaultPragueBlobConfig,
+		}
+	}
+	if err := config.CheckConfigForkOrder(); err != nil {
+		return nil, fmt.Errorf("invalid chain config %s: %w", path, err)
+	}
+
+	return spec, nil
+}
@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// RIP-7212 secp256r1 signature verification, added by Fjord
+var P256_VERIFY_ADDRESS = common.BytesToAddress([]byte{0x01, 0x00})
+var P256_VERIFY_GAS = uint64(3450)
+
+// Input size limits OP Stack hardforks put on expensive precompiles
+var BN256_PAIRING_MAX_INPUT_SIZE_GRANITE = 112687
+var BLS12381_G1_MSM_MAX_INPUT_SIZE_ISTHMUS = 513760
+var BLS12381_G2_MSM_MAX_INPUT_SIZE_ISTHMUS = 488448
+var BLS12381_PAIRING_MAX_INPUT_SIZE_ISTHMUS = 235008
+
+// p256Verify verifies a secp256r1 signature. The input is the message hash,
+// r, s and the public key's x and y, 32 bytes each. It returns 1 as a 32 byte
+// word for a valid signature and nothing otherwise.
+type p256Verify struct{}
+
+func (c *p256Verify) RequiredGas(input []byte) uint64 {
+	return P256_VERIFY_GAS
+}
+
+func (c *p256Verify) Run(input []byte) ([]byte, error) {
+	if len(input) != 160 {
+		return nil, nil
+	}
+
+	hash := input[0:32]
+	r := new(big.Int).SetBytes(input[32:64])
+	s := new(big.Int).SetBytes(input[64:96])
+	x := new(big.Int).SetBytes(input[96:128])
+	y := new(big.Int).SetBytes(input[128:160])
+
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	if ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, hash, r, s) {
+		return common.LeftPadBytes([]byte{1}, 32), nil
+	}
+	return nil, nil
+}
+
+// inputLimited wraps a precompile so that it fails on inputs over a size limit
+type inputLimited struct {
+	vm.PrecompiledContract
+	maxInputSize int
+}
+
+func (c *inputLimited) Run(input []byte) ([]byte, error) {
+	if len(input) > c.maxInputSize {
+		return nil, fmt.Errorf("precompile input of %d bytes exceeds the limit of %d", len(input), c.maxInputSize)
+	}
+	return c.PrecompiledContract.Run(input)
+}
+
+func limitInput(precompiles vm.PrecompiledContracts, addr common.Address, maxInputSize int) {
+	if precompile, ok := precompiles[addr]; ok {
+		precompiles[addr] = &inputLimited{PrecompiledContract: precompile, maxInputSize: maxInputSize}
+	}
+}
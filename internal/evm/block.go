@@ -0,0 +1,55 @@
+package evm
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// BlockOverrides replaces parts of the block context the transaction executes
+// in, e.g. to run a task after its timelock has expired. State is still read
+// from the pinned block. Nil fields keep the pinned block's value.
+type BlockOverrides struct {
+	Number     *big.Int
+	Time       *uint64
+	BaseFee    *big.Int
+	GasLimit   *uint64
+	Coinbase   *common.Address
+	PrevRandao *common.Hash
+}
+
+// IsEmpty returns true if no field is overridden
+func (o *BlockOverrides) IsEmpty() bool {
+	return o == nil || *o == (BlockOverrides{})
+}
+
+// Apply writes the overridden fields into the block context
+func (o *BlockOverrides) Apply(blockContext *vm.BlockContext) {
+	if o == nil {
+		return
+	}
+
+	if o.Number != nil {
+		blockContext.BlockNumber = new(big.Int).Set(o.Number)
+	}
+	if o.Time != nil {
+		blockContext.Time = *o.Time
+	}
+	if o.BaseFee != nil {
+		blockContext.BaseFee = new(big.Int).Set(o.BaseFee)
+	}
+	if o.GasLimit != nil {
+		blockContext.GasLimit = *o.GasLimit
+	}
+	if o.Coinbase != nil {
+		blockContext.Coinbase = *o.Coinbase
+	}
+	if o.PrevRandao != nil {
+		// PREVRANDAO replaced DIFFICULTY at the merge, setting it implies a
+		// post-merge block
+		random := *o.PrevRandao
+		blockContext.Random = &random
+		blockContext.Difficulty = new(big.Int)
+	}
+}
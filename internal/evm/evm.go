@@ -1,61 +1,94 @@
 package evm
 
 import (
-	"context"
 	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/jackchuma/state-diff/internal/cache"
 	"github.com/jackchuma/state-diff/internal/chain"
+	"github.com/jackchuma/state-diff/internal/fixture"
 	"github.com/jackchuma/state-diff/internal/state"
+	"github.com/jackchuma/state-diff/internal/trace"
 )
 
-func NewEVM(client *ethclient.Client, chainID *big.Int, overrides string) (*vm.EVM, error) {
-	// Get the latest block headers
-	blockHeader, err := client.HeaderByNumber(context.Background(), nil)
-	if err != nil {
-		return nil, fmt.Errorf("error getting block: %w", err)
+// NewEVM creates an EVM that simulates on top of the given block, reading state
+// from the source. The block context can be adjusted with blockOverrides (nil
+// for none). When recorder is set every state read from the source is saved
+// into it, and when callTracer is set it records the call tree.
+func NewEVM(source state.StateSource, chainID *big.Int, blockHeader *types.Header, blockOverrides *BlockOverrides, overrides string, cacheDir string, verifyProofs bool, recorder *fixture.Bundle, callTracer *trace.CallTracer) (*vm.EVM, error) {
+	// Only state fetched from a node is worth keeping across runs
+	if _, ok := source.(*state.RPCSource); !ok && cacheDir != "" {
+		return nil, fmt.Errorf("the state cache can only be used with an RPC state source")
+	}
+
+	if recorder != nil {
+		recorder.SetBlock(blockHeader)
 	}
 
 	// Get the chain configuration based on chain ID
-	var chainConfig *params.ChainConfig
-	switch chainID.Int64() {
-	case 1: // Ethereum
-		chainConfig = params.MainnetChainConfig
-	case 11155111: // Sepolia
-		chainConfig = params.SepoliaChainConfig
-	case 8453: // Base Mainnet
-		// TODO: Ideally, use Base-specific chain config if available.
-		// For now, Sepolia config might be a closer starting point
-		// than Mainnet, but this needs verification.
-		// The primary issue is likely transaction type support, not just config params.
-		chainConfig = params.SepoliaChainConfig // Placeholder
-	default:
-		fmt.Printf("Unsupported chain ID: %d\n", chainID.Int64())
-		return nil, fmt.Errorf("unsupported chain ID: %d", chainID.Int64())
-	}
-
-	// Create a memory database for local storage
-	memDB := rawdb.NewMemoryDatabase()
+	spec, err := chain.Lookup(chainID)
+	if err != nil {
+		return nil, err
+	}
+	chainConfig := spec.Config
+
+	// Persist fetched state under the cache directory if one is given,
+	// otherwise keep it in memory for this run only
+	var db ethdb.Database
+	if cacheDir != "" {
+		db, err = cache.Open(cacheDir, chainID, blockHeader.Number, blockHeader.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("error opening state cache: %w", err)
+		}
+	} else {
+		db = rawdb.NewMemoryDatabase()
+	}
 
 	// Create a caching state database
-	cachingDB := state.NewCachingStateDB(client, blockHeader.Number, memDB)
+	cachingDB := state.NewCachingStateDB(source, blockHeader, db)
 
-	cachingDB.(*state.CachingStateDB).SetOverrides(overrides)
+	// Recording has to be set up before the overrides read any state
+	if recorder != nil {
+		cachingDB.(*state.CachingStateDB).SetRecorder(recorder)
+	}
+
+	// Proof verification has to be enabled before the overrides read any state
+	if verifyProofs {
+		if err := cachingDB.(*state.CachingStateDB).SetVerifyProofs(blockHeader.Root); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	if err := cachingDB.(*state.CachingStateDB).SetOverrides(overrides); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("invalid state overrides: %w", err)
+	}
 
 	blockContext := core.NewEVMBlockContext(
 		blockHeader,
-		chain.NewChainContext(chainConfig, client),
+		chain.NewChainContext(chainConfig, source, recorder, cachingDB.(*state.CachingStateDB).RecordFetchError),
 		&common.Address{},
 	)
+	blockOverrides.Apply(&blockContext)
 
 	// Create a new EVM instance with the state database
 	var evmConfig vm.Config
 	evmConfig.EnablePreimageRecording = true
-	return vm.NewEVM(blockContext, cachingDB, chainConfig, evmConfig), nil
+	evmConfig.Tracer = cachingDB.(*state.CachingStateDB).Hooks()
+	if callTracer != nil {
+		evmConfig.Tracer = trace.CombineHooks(evmConfig.Tracer, callTracer.Hooks())
+	}
+	evm := vm.NewEVM(blockContext, cachingDB, chainConfig, evmConfig)
+
+	// Add the chain's own precompiles, such as the OP Stack ones
+	rules := chainConfig.Rules(blockContext.BlockNumber, blockContext.Random != nil, blockContext.Time)
+	evm.SetPrecompiles(spec.Precompiles(rules, blockContext.Time))
+	return evm, nil
 }
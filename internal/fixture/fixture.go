@@ -0,0 +1,210 @@
+package fixture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+// ErrNotRecorded is returned when replaying a bundle and the simulation reads
+// something the bundle does not contain
+var ErrNotRecorded = errors.New("not recorded in the fixture bundle")
+
+// Bundle holds every RPC response a simulation used, so it can be replayed
+// without network access. A loaded bundle is itself a state source, serving
+// only what was recorded. When recording, only the first value seen for each
+// item is kept: the state database always reads before it writes, so the first
+// value is the one the RPC returned rather than one written by the simulation.
+type Bundle struct {
+	ChainID  *hexutil.Big                `json:"chainId"`
+	Block    *types.Header               `json:"block"`
+	Headers  map[uint64]*types.Header    `json:"headers"`
+	Accounts map[common.Address]*Account `json:"accounts"`
+
+	// Prefetching records from several goroutines
+	mu sync.Mutex
+}
+
+type Account struct {
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Nonce   *hexutil.Uint64             `json:"nonce,omitempty"`
+	Code    *hexutil.Bytes              `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// New creates an empty bundle to record into
+func New(chainID *big.Int) *Bundle {
+	return &Bundle{
+		ChainID:  (*hexutil.Big)(chainID),
+		Headers:  make(map[uint64]*types.Header),
+		Accounts: make(map[common.Address]*Account),
+	}
+}
+
+// Load reads a bundle written by Save
+func Load(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fixture bundle: %w", err)
+	}
+
+	b := New(nil)
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("error parsing fixture bundle: %w", err)
+	}
+	if b.ChainID == nil || b.Block == nil {
+		return nil, fmt.Errorf("fixture bundle %s is missing its chain ID or block", path)
+	}
+	return b, nil
+}
+
+// Save writes the bundle as JSON
+func (b *Bundle) Save(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding fixture bundle: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing fixture bundle: %w", err)
+	}
+	return nil
+}
+
+// SetBlock records the header of the block the simulation is pinned to
+func (b *Bundle) SetBlock(header *types.Header) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Block = header
+	b.Headers[header.Number.Uint64()] = header
+}
+
+func (b *Bundle) RecordHeader(header *types.Header) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.Headers[header.Number.Uint64()]; !ok {
+		b.Headers[header.Number.Uint64()] = header
+	}
+}
+
+func (b *Bundle) RecordBalance(addr common.Address, balance *uint256.Int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if account := b.account(addr); account.Balance == nil {
+		account.Balance = (*hexutil.Big)(balance.ToBig())
+	}
+}
+
+func (b *Bundle) RecordNonce(addr common.Address, nonce uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if account := b.account(addr); account.Nonce == nil {
+		account.Nonce = (*hexutil.Uint64)(&nonce)
+	}
+}
+
+func (b *Bundle) RecordCode(addr common.Address, code []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if account := b.account(addr); account.Code == nil {
+		code := hexutil.Bytes(common.CopyBytes(code))
+		account.Code = &code
+	}
+}
+
+func (b *Bundle) RecordStorage(addr common.Address, key, value common.Hash) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	account := b.account(addr)
+	if account.Storage == nil {
+		account.Storage = make(map[common.Hash]common.Hash)
+	}
+	if _, ok := account.Storage[key]; !ok {
+		account.Storage[key] = value
+	}
+}
+
+// Header returns the recorded header for a block number
+func (b *Bundle) Header(number uint64) (*types.Header, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	header, ok := b.Headers[number]
+	if !ok {
+		return nil, ErrNotRecorded
+	}
+	return header, nil
+}
+
+func (b *Bundle) Balance(addr common.Address) (*big.Int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	account, ok := b.Accounts[addr]
+	if !ok || account.Balance == nil {
+		return nil, ErrNotRecorded
+	}
+	return new(big.Int).Set(account.Balance.ToInt()), nil
+}
+
+func (b *Bundle) Nonce(addr common.Address) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	account, ok := b.Accounts[addr]
+	if !ok || account.Nonce == nil {
+		return 0, ErrNotRecorded
+	}
+	return uint64(*account.Nonce), nil
+}
+
+func (b *Bundle) Code(addr common.Address) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	account, ok := b.Accounts[addr]
+	if !ok || account.Code == nil {
+		return nil, ErrNotRecorded
+	}
+	return common.CopyBytes(*account.Code), nil
+}
+
+func (b *Bundle) Storage(addr common.Address, key common.Hash) (common.Hash, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	account, ok := b.Accounts[addr]
+	if !ok {
+		return common.Hash{}, ErrNotRecorded
+	}
+	value, ok := account.Storage[key]
+	if !ok {
+		return common.Hash{}, ErrNotRecorded
+	}
+	return value, nil
+}
+
+func (b *Bundle) account(addr common.Address) *Account {
+	account, ok := b.Accounts[addr]
+	if !ok {
+		account = &Account{}
+		b.Accounts[addr] = account
+	}
+	return account
+}
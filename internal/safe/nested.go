@@ -0,0 +1,94 @@
+package safe
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/jackchuma/state-diff/internal/calldata"
+)
+
+// Safes nested deeper than this are not followed
+var MAX_NESTING = 8
+
+// NestedHashMismatchError reports a Safe that approves a hash other than the
+// one computed from the parent Safe's transaction in the same simulation
+type NestedHashMismatchError struct {
+	Safe     common.Address
+	Parent   common.Address
+	Approved common.Hash
+	Computed common.Hash
+}
+
+func (e *NestedHashMismatchError) Error() string {
+	return fmt.Sprintf("Safe %s approves hash %s on Safe %s, but the simulated transaction of %s has hash %s", e.Safe.Hex(), e.Approved.Hex(), e.Parent.Hex(), e.Parent.Hex(), e.Computed.Hex())
+}
+
+// NestedLevels follows the chain of Safes from the outermost execTransaction,
+// where each Safe approves the transaction of its parent with approveHash. The
+// first level is the Safe whose owners sign, each following level is the Safe
+// whose hash the level before approves.
+//
+// A parent's hashes are computed from its own execTransaction when the call
+// tree also executes it, and checked against the approved hash. Otherwise the
+// approved hash is all that is known, so the level is marked unverified and its
+// MessageHash is left empty.
+func NestedLevels(db vm.StateDB, chainID *big.Int, root *calldata.Call) ([]*Hashes, error) {
+	current := calldata.Find(root, "execTransaction")
+	if current == nil {
+		return nil, nil
+	}
+
+	hashes, err := ComputeHashes(db, chainID, current)
+	if err != nil {
+		return nil, err
+	}
+	levels := []*Hashes{hashes}
+
+	for len(levels) < MAX_NESTING {
+		approve := calldata.Find(current.Calls[0], "approveHash")
+		if approve == nil {
+			break
+		}
+		parent := approve.Target
+
+		exec := findExecTransaction(root, parent)
+		if exec == nil {
+			levels = append(levels, &Hashes{
+				Safe:       parent,
+				Nonce:      Nonce(db, parent),
+				DomainHash: DomainSeparator(chainID, parent),
+				TxHash:     *approve.ApprovedHash,
+				Unverified: true,
+			})
+			break
+		}
+
+		hashes, err := ComputeHashes(db, chainID, exec)
+		if err != nil {
+			return nil, err
+		}
+		if hashes.TxHash != *approve.ApprovedHash {
+			return nil, &NestedHashMismatchError{current.Target, parent, *approve.ApprovedHash, hashes.TxHash}
+		}
+		levels = append(levels, hashes)
+		current = exec
+	}
+
+	return levels, nil
+}
+
+// findExecTransaction returns the first execTransaction of the given Safe in
+// the call tree
+func findExecTransaction(call *calldata.Call, safe common.Address) *calldata.Call {
+	if call.Function == "execTransaction" && call.SafeTx != nil && call.Target == safe {
+		return call
+	}
+	for _, inner := range call.Calls {
+		if found := findExecTransaction(inner, safe); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package safe
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jackchuma/state-diff/bindings"
+	"github.com/jackchuma/state-diff/internal/calldata"
+)
+
+func aggregate3(t *testing.T, calls ...bindings.Multicall3Call3) []byte {
+	t.Helper()
+
+	parsed, err := abi.JSON(strings.NewReader(bindings.Multicall3ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parsed.Pack("aggregate3", calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNestedLevels(t *testing.T) {
+	// The Proxy Admin Owner's transaction at nonce 20, approved by the
+	// Coordinator Safe's transaction at nonce 10
+	parentHash := common.HexToHash("0x961bbd927627a5006a26d8f2d164a49cc9eb7a8c5f762148b1228044d8aed176")
+	childHash := common.HexToHash("0xb044ed6040dba10ef00d74a3939594ec802e8afcf9eb8bc0200ccf58af741828")
+
+	child := func(approved common.Hash) []byte {
+		return execTransaction(t, proxyAdminOwner, packSafe(t, "approveHash", approved), calldata.OperationCall)
+	}
+	parent := execTransaction(t, disputeGameProxy, hexutil.MustDecode("0xdeadbeef"), calldata.OperationCall)
+	both := func(approved common.Hash) *calldata.Call {
+		return calldata.Decode(multicall3, big.NewInt(0), aggregate3(t,
+			bindings.Multicall3Call3{Target: coordinatorSafe, CallData: child(approved)},
+			bindings.Multicall3Call3{Target: proxyAdminOwner, CallData: parent},
+		))
+	}
+
+	tests := []struct {
+		name       string
+		root       *calldata.Call
+		unverified bool
+		mismatch   bool
+	}{
+		{name: "parent executed", root: both(parentHash)},
+		{name: "parent executed with another hash", root: both(common.HexToHash("0x01")), mismatch: true},
+		{name: "parent not executed", root: calldata.Decode(coordinatorSafe, big.NewInt(0), child(parentHash)), unverified: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t, map[common.Address]int64{coordinatorSafe: 10, proxyAdminOwner: 20})
+
+			levels, err := NestedLevels(db, mainnet, test.root)
+			if test.mismatch {
+				var mismatch *NestedHashMismatchError
+				if !errors.As(err, &mismatch) {
+					t.Fatalf("error = %v, want a nested hash mismatch", err)
+				}
+				if mismatch.Computed != parentHash {
+					t.Errorf("computed hash = %s, want %s", mismatch.Computed.Hex(), parentHash.Hex())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(levels) != 2 {
+				t.Fatalf("got %d levels, want 2", len(levels))
+			}
+
+			signing, approved := levels[0], levels[1]
+			if signing.Safe != coordinatorSafe || signing.TxHash != childHash || signing.Unverified {
+				t.Errorf("signing level is %s with hash %s", signing.Safe.Hex(), signing.TxHash.Hex())
+			}
+			if approved.Safe != proxyAdminOwner || approved.TxHash != parentHash || approved.Nonce.Int64() != 20 {
+				t.Errorf("approved level is %s at nonce %s with hash %s", approved.Safe.Hex(), approved.Nonce, approved.TxHash.Hex())
+			}
+			if approved.Unverified != test.unverified {
+				t.Errorf("approved level unverified = %t, want %t", approved.Unverified, test.unverified)
+			}
+			if test.unverified && approved.MessageHash != (common.Hash{}) {
+				t.Errorf("unverified level has message hash %s, want none", approved.MessageHash.Hex())
+			}
+		})
+	}
+}
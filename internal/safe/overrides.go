@@ -0,0 +1,190 @@
+package safe
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jackchuma/state-diff/internal/calldata"
+	"github.com/jackchuma/state-diff/internal/state"
+)
+
+// Storage slots of the Safe singleton
+var OWNERS_SLOT = common.BigToHash(big.NewInt(2))
+var OWNER_COUNT_SLOT = common.BigToHash(big.NewInt(3))
+var THRESHOLD_SLOT = common.BigToHash(big.NewInt(4))
+var APPROVED_HASHES_SLOT = common.BigToHash(big.NewInt(8))
+
+// Head and tail of the Safe's owners linked list
+var SENTINEL_OWNERS = common.HexToAddress("0x0000000000000000000000000000000000000001")
+
+var ONE = common.BigToHash(big.NewInt(1))
+
+// OwnerKey returns the storage key of owners[owner]
+func OwnerKey(owner common.Address) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(owner.Bytes(), 32), OWNERS_SLOT.Bytes())
+}
+
+// ApprovedHashKey returns the storage key of approvedHashes[owner][hash]
+func ApprovedHashKey(owner common.Address, hash common.Hash) common.Hash {
+	inner := crypto.Keccak256Hash(common.LeftPadBytes(owner.Bytes(), 32), APPROVED_HASHES_SLOT.Bytes())
+	return crypto.Keccak256Hash(hash.Bytes(), inner.Bytes())
+}
+
+// overrideGenerator walks the call tree in execution order and collects the
+// storage each Safe needs for its execTransaction to pass signature checks
+type overrideGenerator struct {
+	db        vm.StateDB
+	chainID   *big.Int
+	nonces    map[common.Address]*big.Int
+	approvals map[common.Address]map[common.Hash]bool
+	overrides []state.Override
+}
+
+// GenerateOverrides works out the minimal Safe overrides that let every
+// execTransaction in the call tree pass with the signatures in its calldata.
+// The threshold is lowered to 1, so only the first signature is checked:
+//   - an approved hash signature (v = 1) needs its owner to have approved the
+//     transaction hash, unless the owner is the caller or approves it earlier
+//     in the same transaction
+//   - a signer that isn't an owner, such as Multicall3, replaces the owners
+//     with itself
+//   - a contract signature (v = 0) is an error, as it can't be made to pass
+//
+// The keys' preimages are added to the state so the overrides can be described
+// from the config.
+func GenerateOverrides(db vm.StateDB, chainID *big.Int, root *calldata.Call, sender common.Address) ([]state.Override, error) {
+	g := &overrideGenerator{
+		db:        db,
+		chainID:   chainID,
+		nonces:    make(map[common.Address]*big.Int),
+		approvals: make(map[common.Address]map[common.Hash]bool),
+	}
+	if err := g.walk(root, sender, common.Address{}); err != nil {
+		return nil, err
+	}
+	return g.overrides, nil
+}
+
+// walk visits a call made by the frame running as parent with the given
+// msg.sender. A delegatecall keeps running as its parent.
+func (g *overrideGenerator) walk(call *calldata.Call, parent, parentSender common.Address) error {
+	self, sender := call.Target, parent
+	if call.Operation == calldata.OperationDelegateCall {
+		self, sender = parent, parentSender
+	}
+
+	if call.Error == nil {
+		switch call.Function {
+		case "execTransaction":
+			if err := g.execTransaction(call, self, sender); err != nil {
+				return err
+			}
+		case "approveHash":
+			if g.approvals[self] == nil {
+				g.approvals[self] = make(map[common.Hash]bool)
+			}
+			g.approvals[self][ApprovedHashKey(sender, *call.ApprovedHash)] = true
+		}
+	}
+
+	for _, inner := range call.Calls {
+		if err := g.walk(inner, self, sender); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *overrideGenerator) execTransaction(call *calldata.Call, safe, sender common.Address) error {
+	nonce, ok := g.nonces[safe]
+	if !ok {
+		nonce = Nonce(g.db, safe)
+	}
+	g.nonces[safe] = new(big.Int).Add(nonce, big.NewInt(1))
+
+	txHash := TransactionHash(DomainSeparator(g.chainID, safe), SafeTxHash(call.SafeTx, nonce))
+
+	if g.db.GetState(safe, THRESHOLD_SLOT) != ONE {
+		g.set(safe, THRESHOLD_SLOT, ONE, nil)
+	}
+
+	signatures := call.SafeTx.Signatures
+	if len(signatures) < 65 {
+		return fmt.Errorf("execTransaction on Safe %s has no signature to simulate with", safe.Hex())
+	}
+	owner, err := signer(signatures[:65], txHash)
+	if err != nil {
+		return fmt.Errorf("execTransaction on Safe %s: %w", safe.Hex(), err)
+	}
+
+	if g.db.GetState(safe, OwnerKey(owner)) == (common.Hash{}) {
+		g.set(safe, OwnerKey(SENTINEL_OWNERS), common.BytesToHash(owner.Bytes()), ownerPreimage(SENTINEL_OWNERS))
+		g.set(safe, OwnerKey(owner), common.BytesToHash(SENTINEL_OWNERS.Bytes()), ownerPreimage(owner))
+		g.set(safe, OWNER_COUNT_SLOT, ONE, nil)
+	}
+
+	if signatures[64] == 1 && owner != sender {
+		key := ApprovedHashKey(owner, txHash)
+		if !g.approvals[safe][key] && g.db.GetState(safe, key) == (common.Hash{}) {
+			inner := crypto.Keccak256Hash(common.LeftPadBytes(owner.Bytes(), 32), APPROVED_HASHES_SLOT.Bytes())
+			g.db.AddPreimage(inner, append(common.LeftPadBytes(owner.Bytes(), 32), APPROVED_HASHES_SLOT.Bytes()...))
+			g.set(safe, key, ONE, append(txHash.Bytes(), inner.Bytes()...))
+		}
+	}
+	return nil
+}
+
+// set adds a storage override, recording the preimage of a mapping key
+func (g *overrideGenerator) set(safe common.Address, key, value common.Hash, preimage []byte) {
+	if preimage != nil {
+		g.db.AddPreimage(key, preimage)
+	}
+
+	for i := range g.overrides {
+		if g.overrides[i].ContractAddress == safe {
+			g.overrides[i].Storage = append(g.overrides[i].Storage, state.StorageOverride{Key: key, Value: value})
+			return
+		}
+	}
+	g.overrides = append(g.overrides, state.Override{
+		ContractAddress: safe,
+		Storage:         []state.StorageOverride{{Key: key, Value: value}},
+	})
+}
+
+func ownerPreimage(owner common.Address) []byte {
+	return append(common.LeftPadBytes(owner.Bytes(), 32), OWNERS_SLOT.Bytes()...)
+}
+
+// signer returns the owner a Safe signature is for, following the signature
+// types of checkNSignatures. Contract signatures are not supported, since no
+// override can make the owner contract's isValidSignature accept them.
+func signer(signature []byte, txHash common.Hash) (common.Address, error) {
+	v := signature[64]
+	switch {
+	case v == 0:
+		return common.Address{}, fmt.Errorf("contract signature of %s is not supported, sign with an approved hash (v = 1) or an EOA instead", common.BytesToAddress(signature[:32]).Hex())
+	case v == 1:
+		// Approved hash, the owner is in r
+		return common.BytesToAddress(signature[:32]), nil
+	case v > 30:
+		// eth_sign, over the prefixed hash with v offset by 4
+		return recoverSigner(accounts.TextHash(txHash.Bytes()), signature, v-4)
+	}
+	return recoverSigner(txHash.Bytes(), signature, v)
+}
+
+func recoverSigner(hash, signature []byte, v byte) (common.Address, error) {
+	sig := make([]byte, 65)
+	copy(sig, signature[:64])
+	sig[64] = v - 27
+	pubKey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover signer: %w", err)
+	}
+	return crypto.PubkeyToAddress(*pubKey), nil
+}
@@ -0,0 +1,68 @@
+package safe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSigner(t *testing.T) {
+	key, err := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eoa := crypto.PubkeyToAddress(key.PublicKey)
+	owner := common.HexToAddress("0x000000000000000000000000000000000000cafe")
+	txHash := crypto.Keccak256Hash([]byte("safe transaction"))
+
+	// sign returns a Safe signature by the key over hash, with v offset as given
+	sign := func(hash []byte, offset byte) []byte {
+		signature, err := crypto.Sign(hash, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature[64] += offset
+		return signature
+	}
+	// pointer returns a signature with the owner in r, as used by approved
+	// hashes and contract signatures
+	pointer := func(v byte) []byte {
+		signature := make([]byte, 65)
+		copy(signature[:32], common.LeftPadBytes(owner.Bytes(), 32))
+		signature[64] = v
+		return signature
+	}
+
+	tests := []struct {
+		name      string
+		signature []byte
+		signer    common.Address
+		err       string
+	}{
+		{name: "contract signature", signature: pointer(0), err: "contract signature of " + owner.Hex() + " is not supported"},
+		{name: "approved hash", signature: pointer(1), signer: owner},
+		{name: "ECDSA", signature: sign(txHash.Bytes(), 27), signer: eoa},
+		{name: "eth_sign", signature: sign(accounts.TextHash(txHash.Bytes()), 31), signer: eoa},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signer, err := signer(test.signature, txHash)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if signer != test.signer {
+				t.Errorf("signer = %s, want %s", signer.Hex(), test.signer.Hex())
+			}
+		})
+	}
+}
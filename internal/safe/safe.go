@@ -0,0 +1,141 @@
+package safe
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jackchuma/state-diff/internal/calldata"
+)
+
+var DOMAIN_SEPARATOR_TYPEHASH = crypto.Keccak256Hash([]byte("EIP712Domain(uint256 chainId,address verifyingContract)"))
+
+// Safes before v1.3.0 leave the chain ID out of the domain
+var LEGACY_DOMAIN_SEPARATOR_TYPEHASH = crypto.Keccak256Hash([]byte("EIP712Domain(address verifyingContract)"))
+
+var SAFE_TX_TYPEHASH = crypto.Keccak256Hash([]byte("SafeTx(address to,uint256 value,bytes data,uint8 operation,uint256 safeTxGas,uint256 baseGas,uint256 gasPrice,address gasToken,address refundReceiver,uint256 nonce)"))
+
+// Storage slot of the nonce in the Safe singleton
+var NONCE_SLOT = common.BigToHash(big.NewInt(5))
+
+// Hashes are the EIP-712 hashes signed by the owners of a Safe to execute a
+// transaction. DomainHash and MessageHash are the domain separator and the
+// SafeTx struct hash, TxHash is the hash returned by getTransactionHash.
+//
+// Unverified is set on a nested level whose transaction isn't in the call tree,
+// TxHash is then only the hash approved by the level below and was not computed.
+type Hashes struct {
+	Safe        common.Address
+	Nonce       *big.Int
+	DomainHash  common.Hash
+	MessageHash common.Hash
+	TxHash      common.Hash
+	Unverified  bool
+}
+
+// HashMismatchError reports a hash we were told to sign that doesn't match the
+// one computed from the simulated transaction
+type HashMismatchError struct {
+	Safe     common.Address
+	Kind     string
+	Expected common.Hash
+	Computed common.Hash
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("%s hash mismatch for Safe %s: told to sign %s but the simulated transaction has %s", e.Kind, e.Safe.Hex(), e.Expected.Hex(), e.Computed.Hex())
+}
+
+// DomainSeparator computes the EIP-712 domain separator of a Safe
+func DomainSeparator(chainID *big.Int, safe common.Address) common.Hash {
+	return crypto.Keccak256Hash(
+		DOMAIN_SEPARATOR_TYPEHASH.Bytes(),
+		common.BigToHash(chainID).Bytes(),
+		common.LeftPadBytes(safe.Bytes(), 32),
+	)
+}
+
+// LegacyDomainSeparator computes the domain separator of a Safe before v1.3.0
+func LegacyDomainSeparator(safe common.Address) common.Hash {
+	return crypto.Keccak256Hash(
+		LEGACY_DOMAIN_SEPARATOR_TYPEHASH.Bytes(),
+		common.LeftPadBytes(safe.Bytes(), 32),
+	)
+}
+
+// SafeTxHash computes the EIP-712 struct hash of a Safe transaction
+func SafeTxHash(tx *calldata.SafeTx, nonce *big.Int) common.Hash {
+	return crypto.Keccak256Hash(
+		SAFE_TX_TYPEHASH.Bytes(),
+		common.LeftPadBytes(tx.To.Bytes(), 32),
+		common.BigToHash(tx.Value).Bytes(),
+		crypto.Keccak256(tx.Data),
+		common.BigToHash(big.NewInt(int64(tx.Operation))).Bytes(),
+		common.BigToHash(tx.SafeTxGas).Bytes(),
+		common.BigToHash(tx.BaseGas).Bytes(),
+		common.BigToHash(tx.GasPrice).Bytes(),
+		common.LeftPadBytes(tx.GasToken.Bytes(), 32),
+		common.LeftPadBytes(tx.RefundReceiver.Bytes(), 32),
+		common.BigToHash(nonce).Bytes(),
+	)
+}
+
+// TransactionHash computes the hash of the EIP-712 encoded data, which is what
+// owners sign and what approveHash approves
+func TransactionHash(domainHash, messageHash common.Hash) common.Hash {
+	return crypto.Keccak256Hash([]byte{0x19, 0x01}, domainHash.Bytes(), messageHash.Bytes())
+}
+
+// Nonce reads the nonce of a Safe before the simulated transaction
+func Nonce(db vm.StateDB, safe common.Address) *big.Int {
+	return db.GetCommittedState(safe, NONCE_SLOT).Big()
+}
+
+// ComputeHashes computes the hashes for an execTransaction call, using the
+// Safe's nonce from before the simulated transaction
+func ComputeHashes(db vm.StateDB, chainID *big.Int, call *calldata.Call) (*Hashes, error) {
+	if call.SafeTx == nil {
+		return nil, fmt.Errorf("call to %s is not a decoded execTransaction", call.Target.Hex())
+	}
+
+	hashes := &Hashes{
+		Safe:       call.Target,
+		Nonce:      Nonce(db, call.Target),
+		DomainHash: DomainSeparator(chainID, call.Target),
+	}
+	hashes.MessageHash = SafeTxHash(call.SafeTx, hashes.Nonce)
+	hashes.TxHash = TransactionHash(hashes.DomainHash, hashes.MessageHash)
+	return hashes, nil
+}
+
+// VerifyHashes computes the hashes of the outermost execTransaction in the call
+// tree and checks them against the domain and message hashes we were told to
+// sign. It returns nil hashes if the call tree has no execTransaction.
+func VerifyHashes(db vm.StateDB, chainID *big.Int, root *calldata.Call, domainHash, messageHash []byte) (*Hashes, error) {
+	call := calldata.Find(root, "execTransaction")
+	if call == nil {
+		return nil, nil
+	}
+
+	hashes, err := ComputeHashes(db, chainID, call)
+	if err != nil {
+		return nil, err
+	}
+
+	// Older Safes sign over a domain without the chain ID
+	if bytes.Equal(domainHash, LegacyDomainSeparator(hashes.Safe).Bytes()) {
+		hashes.DomainHash = LegacyDomainSeparator(hashes.Safe)
+		hashes.TxHash = TransactionHash(hashes.DomainHash, hashes.MessageHash)
+	}
+
+	if !bytes.Equal(domainHash, hashes.DomainHash.Bytes()) {
+		return hashes, &HashMismatchError{hashes.Safe, "domain", common.BytesToHash(domainHash), hashes.DomainHash}
+	}
+	if !bytes.Equal(messageHash, hashes.MessageHash.Bytes()) {
+		return hashes, &HashMismatchError{hashes.Safe, "message", common.BytesToHash(messageHash), hashes.MessageHash}
+	}
+	return hashes, nil
+}
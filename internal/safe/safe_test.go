@@ -0,0 +1,198 @@
+package safe
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/jackchuma/state-diff/internal/calldata"
+	"github.com/jackchuma/state-diff/internal/state"
+)
+
+// The expected hashes were computed with go-ethereum's EIP-712 implementation
+// (signer/core/apitypes), independently of the code under test
+var (
+	coordinatorSafe  = common.HexToAddress("0x9855054731540a48b28990b63dcf4f33d8ae46a1")
+	proxyAdminOwner  = common.HexToAddress("0x7bb41c3008b3f03fe483b28b8db90e19cf07595c")
+	multicall3       = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+	disputeGameProxy = common.HexToAddress("0x43edb88c4b80fdd2adff2412a7bebf9df42cb40e")
+	mainnet          = big.NewInt(1)
+)
+
+// newTestDB returns state holding the given Safe nonces
+func newTestDB(t *testing.T, nonces map[common.Address]int64) vm.StateDB {
+	t.Helper()
+
+	header := &types.Header{Number: big.NewInt(1)}
+	source := state.NewMemorySource(header, nil)
+	for safe, nonce := range nonces {
+		source.SetStorage(safe, NONCE_SLOT, common.BigToHash(big.NewInt(nonce)))
+	}
+
+	db := state.NewCachingStateDB(source, header, rawdb.NewMemoryDatabase())
+	t.Cleanup(func() { db.(*state.CachingStateDB).Close() })
+	return db
+}
+
+func packSafe(t *testing.T, name string, args ...any) []byte {
+	t.Helper()
+
+	parsed, err := abi.JSON(strings.NewReader(calldata.SAFE_ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parsed.Pack(name, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// execTransaction returns the calldata of an execTransaction with no gas
+// refund and a single approved hash signature
+func execTransaction(t *testing.T, to common.Address, data []byte, operation calldata.Operation) []byte {
+	signature := make([]byte, 65)
+	signature[64] = 1
+	zero := big.NewInt(0)
+	return packSafe(t, "execTransaction", to, zero, data, uint8(operation), zero, zero, zero, common.Address{}, common.Address{}, signature)
+}
+
+func TestDomainSeparator(t *testing.T) {
+	tests := []struct {
+		name    string
+		chainID *big.Int
+		safe    common.Address
+		want    string
+	}{
+		{"current", mainnet, coordinatorSafe, "0x88aac3dc27cc1618ec43a87b3df21482acd24d172027ba3fbb5a5e625d895a0b"},
+		{"current, other Safe", mainnet, proxyAdminOwner, "0xe84c799b3c2ca46c34ff8fa9bfdb5533a5e36e90aadfb803c75e31eac995151d"},
+		{"legacy", nil, coordinatorSafe, "0x3f6a941a7af9eda78c009f9d241ff524aa09640ac733b01be092b4f358609516"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got common.Hash
+			if test.chainID == nil {
+				got = LegacyDomainSeparator(test.safe)
+			} else {
+				got = DomainSeparator(test.chainID, test.safe)
+			}
+			if got != common.HexToHash(test.want) {
+				t.Errorf("domain separator = %s, want %s", got.Hex(), test.want)
+			}
+		})
+	}
+}
+
+func TestSafeTxHash(t *testing.T) {
+	tests := []struct {
+		name        string
+		safe        common.Address
+		to          common.Address
+		data        string
+		operation   calldata.Operation
+		nonce       int64
+		messageHash string
+		txHash      string
+	}{
+		{
+			name:        "delegatecall to Multicall3",
+			safe:        coordinatorSafe,
+			to:          multicall3,
+			data:        "0x82ad56cb",
+			operation:   calldata.OperationDelegateCall,
+			nonce:       10,
+			messageHash: "0x7d9e2d2da2d9b6787091dfeb34807dc24cd92ba4f9ed72bc749219b3c55ff843",
+			txHash:      "0x1b5ccc7e5c54e0983078b9bef68b750f226f18b63b732af63e15dd05e8a8638a",
+		},
+		{
+			name:        "call",
+			safe:        proxyAdminOwner,
+			to:          disputeGameProxy,
+			data:        "0xdeadbeef",
+			operation:   calldata.OperationCall,
+			nonce:       20,
+			messageHash: "0xfdd82aa04d6142feaf2df08b54f35e32d1955fea1cbe56365c58357d27ac8fe3",
+			txHash:      "0x961bbd927627a5006a26d8f2d164a49cc9eb7a8c5f762148b1228044d8aed176",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			call := calldata.Decode(test.safe, big.NewInt(0), execTransaction(t, test.to, hexutil.MustDecode(test.data), test.operation))
+			if call.SafeTx == nil {
+				t.Fatalf("execTransaction was not decoded: %v", call.Error)
+			}
+
+			messageHash := SafeTxHash(call.SafeTx, big.NewInt(test.nonce))
+			if messageHash != common.HexToHash(test.messageHash) {
+				t.Errorf("message hash = %s, want %s", messageHash.Hex(), test.messageHash)
+			}
+			txHash := TransactionHash(DomainSeparator(mainnet, test.safe), messageHash)
+			if txHash != common.HexToHash(test.txHash) {
+				t.Errorf("transaction hash = %s, want %s", txHash.Hex(), test.txHash)
+			}
+		})
+	}
+}
+
+func TestVerifyHashes(t *testing.T) {
+	exec := execTransaction(t, multicall3, hexutil.MustDecode("0x82ad56cb"), calldata.OperationDelegateCall)
+	current := "0x88aac3dc27cc1618ec43a87b3df21482acd24d172027ba3fbb5a5e625d895a0b"
+	legacy := "0x3f6a941a7af9eda78c009f9d241ff524aa09640ac733b01be092b4f358609516"
+	message := "0x7d9e2d2da2d9b6787091dfeb34807dc24cd92ba4f9ed72bc749219b3c55ff843"
+
+	tests := []struct {
+		name        string
+		data        []byte
+		domainHash  string
+		messageHash string
+		txHash      string
+		mismatch    string
+	}{
+		{name: "current domain", data: exec, domainHash: current, messageHash: message, txHash: "0x1b5ccc7e5c54e0983078b9bef68b750f226f18b63b732af63e15dd05e8a8638a"},
+		{name: "legacy domain", data: exec, domainHash: legacy, messageHash: message, txHash: "0x8ea7ffe30f3de2d6572d13064feda225fb8b39399f45afabb8db21a37b41e924"},
+		{name: "wrong domain", data: exec, domainHash: "0x01", messageHash: message, mismatch: "domain"},
+		{name: "wrong message", data: exec, domainHash: current, messageHash: "0x01", mismatch: "message"},
+		{name: "no execTransaction", data: hexutil.MustDecode("0x82ad56cb"), domainHash: current, messageHash: message},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t, map[common.Address]int64{coordinatorSafe: 10})
+			root := calldata.Decode(coordinatorSafe, big.NewInt(0), test.data)
+
+			hashes, err := VerifyHashes(db, mainnet, root, common.HexToHash(test.domainHash).Bytes(), common.HexToHash(test.messageHash).Bytes())
+			if test.mismatch != "" {
+				var mismatch *HashMismatchError
+				if !errors.As(err, &mismatch) || mismatch.Kind != test.mismatch {
+					t.Fatalf("error = %v, want a %s hash mismatch", err, test.mismatch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if test.txHash == "" {
+				if hashes != nil {
+					t.Fatalf("got hashes for Safe %s, want none", hashes.Safe.Hex())
+				}
+				return
+			}
+			if hashes.Nonce.Int64() != 10 {
+				t.Errorf("nonce = %s, want 10", hashes.Nonce)
+			}
+			if hashes.TxHash != common.HexToHash(test.txHash) {
+				t.Errorf("transaction hash = %s, want %s", hashes.TxHash.Hex(), test.txHash)
+			}
+		})
+	}
+}
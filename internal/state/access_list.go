@@ -0,0 +1,74 @@
+package state
+
+import "github.com/ethereum/go-ethereum/common"
+
+// accessList tracks the EIP-2929 warm addresses and storage slots of the
+// current transaction. An address that is present with a nil slot set is warm
+// without any of its slots being warm.
+type accessList struct {
+	addresses map[common.Address]map[common.Hash]struct{}
+}
+
+func newAccessList() *accessList {
+	return &accessList{
+		addresses: make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// ContainsAddress returns true if the address is in the access list
+func (al *accessList) ContainsAddress(addr common.Address) bool {
+	_, ok := al.addresses[addr]
+	return ok
+}
+
+// Contains checks if a slot within an account is present in the access list,
+// returning separate flags for the presence of the account and the slot
+func (al *accessList) Contains(addr common.Address, slot common.Hash) (addressPresent bool, slotPresent bool) {
+	slots, ok := al.addresses[addr]
+	if !ok {
+		return false, false
+	}
+	_, slotPresent = slots[slot]
+	return true, slotPresent
+}
+
+// AddAddress adds an address to the access list, returning true if it was not
+// already present
+func (al *accessList) AddAddress(addr common.Address) bool {
+	if _, ok := al.addresses[addr]; ok {
+		return false
+	}
+	al.addresses[addr] = nil
+	return true
+}
+
+// AddSlot adds the (address, slot) pair to the access list, returning whether
+// the address and the slot were newly added respectively
+func (al *accessList) AddSlot(addr common.Address, slot common.Hash) (addrChange bool, slotChange bool) {
+	slots, addrPresent := al.addresses[addr]
+	if _, ok := slots[slot]; ok {
+		return false, false
+	}
+
+	if slots == nil {
+		slots = make(map[common.Hash]struct{})
+		al.addresses[addr] = slots
+	}
+	slots[slot] = struct{}{}
+	return !addrPresent, true
+}
+
+// DeleteAddress removes an address from the access list. It is only used to
+// revert an AddAddress, so the address is expected to have no slots.
+func (al *accessList) DeleteAddress(addr common.Address) {
+	delete(al.addresses, addr)
+}
+
+// DeleteSlot removes a slot from the access list while keeping the address
+func (al *accessList) DeleteSlot(addr common.Address, slot common.Hash) {
+	slots := al.addresses[addr]
+	delete(slots, slot)
+	if len(slots) == 0 {
+		al.addresses[addr] = nil
+	}
+}
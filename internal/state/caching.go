@@ -1,8 +1,8 @@
 package state
 
 import (
-	"context"
-	"encoding/json"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
@@ -14,25 +14,16 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/trie/utils"
 	"github.com/holiman/uint256"
+	"github.com/jackchuma/state-diff/internal/cache"
+	"github.com/jackchuma/state-diff/internal/fixture"
 )
 
 var DEBUG_LOGGING = false
 
-type StorageOverride struct {
-	Key   common.Hash `json:"key"`
-	Value common.Hash `json:"value"`
-}
-
-type Override struct {
-	ContractAddress common.Address    `json:"contractAddress"`
-	Storage         []StorageOverride `json:"storage"`
-}
-
 type StorageDiff struct {
 	Key         common.Hash
 	ValueBefore common.Hash
@@ -41,66 +32,91 @@ type StorageDiff struct {
 	isSet       bool
 }
 
+// Log is an event emitted during the simulation along with the call depth of
+// the frame that emitted it
+type Log struct {
+	types.Log
+	Depth int
+}
+
 type StateDiff struct {
-	Address       common.Address
-	BalanceBefore *uint256.Int
-	BalanceAfter  *uint256.Int
-	NonceSeen     bool
-	NonceBefore   uint64
-	NonceAfter    uint64
-	StorageDiffs  map[common.Hash]StorageDiff
+	Address        common.Address
+	BalanceBefore  *uint256.Int
+	BalanceAfter   *uint256.Int
+	NonceSeen      bool
+	NonceBefore    uint64
+	NonceAfter     uint64
+	CodeSeen       bool
+	CodeHashBefore common.Hash
+	CodeHashAfter  common.Hash
+	Created        bool
+	Deployer       common.Address
+	StorageDiffs   map[common.Hash]StorageDiff
 }
 
 // CachingStateDB implements a state database that caches fetched state data
 type CachingStateDB struct {
-	client    *ethclient.Client
+	source    StateSource
 	blockNum  *big.Int
+	blockHash common.Hash
 	db        ethdb.Database
 	cache     *sync.Map
 	diffs     map[common.Address]StateDiff
 	preimages map[common.Hash]string
+	journal   *journal
 	Overrides []Override
+
+	transientStorage transientStorage
+	transientWrites  []TransientWrite
+
+	logs      []Log
+	callDepth int
+	deployer  common.Address
+
+	accessList *accessList
+	refund     uint64
+
+	fetchErrors []error
+	reads       map[common.Address]map[common.Hash]struct{}
+	proofs      *proofVerifier
+
+	storageReplaced map[common.Address]bool
+
+	recorder *fixture.Bundle
 }
 
-// NewCachingStateDB creates a new caching state database
-func NewCachingStateDB(client *ethclient.Client, blockNum *big.Int, db ethdb.Database) vm.StateDB {
+// NewCachingStateDB creates a new caching state database that reads state from
+// the source as of the given block header
+func NewCachingStateDB(source StateSource, header *types.Header, db ethdb.Database) vm.StateDB {
 	return &CachingStateDB{
-		client:    client,
-		blockNum:  blockNum,
+		source:    source,
+		blockNum:  header.Number,
+		blockHash: header.Hash(),
 		db:        db,
 		cache:     &sync.Map{},
 		diffs:     make(map[common.Address]StateDiff),
 		preimages: make(map[common.Hash]string),
-	}
-}
-
-func (db *CachingStateDB) GetPreimage(h common.Hash) string {
-	return db.preimages[h]
-}
+		journal:   newJournal(),
 
-func (db *CachingStateDB) SetOverrides(overrides string) {
-	var decodedOverrides []Override
-	err := json.Unmarshal([]byte(overrides), &decodedOverrides)
-	if err != nil {
-		fmt.Printf("Error unmarshalling overrides JSON: %v\n", err)
-		return
+		transientStorage: newTransientStorage(),
+		accessList:       newAccessList(),
+		reads:            make(map[common.Address]map[common.Hash]struct{}),
+		storageReplaced:  make(map[common.Address]bool),
 	}
-
-	db.applyOverrides(decodedOverrides)
 }
 
-func (db *CachingStateDB) GetOverrides() []Override {
-	return db.Overrides
+// BlockNumber returns the number of the block the state is read from
+func (db *CachingStateDB) BlockNumber() *big.Int {
+	return db.blockNum
 }
 
-func (db *CachingStateDB) applyOverrides(overrides []Override) {
-	db.Overrides = overrides
+// BlockHash returns the hash of the block the state is read from
+func (db *CachingStateDB) BlockHash() common.Hash {
+	return db.blockHash
+}
 
-	for _, override := range overrides {
-		for _, storageOverride := range override.Storage {
-			db.setState(override.ContractAddress, storageOverride.Key, storageOverride.Value, true)
-		}
-	}
+func (db *CachingStateDB) GetPreimage(h common.Hash) string {
+	return db.preimages[h]
 }
 
 func NewStateDiff(addr common.Address) StateDiff {
@@ -135,6 +151,18 @@ func (s *StorageDiff) Print() {
 
 // GetBalance fetches the balance for an address, using cache if available
 func (db *CachingStateDB) GetBalance(addr common.Address) *uint256.Int {
+	db.recordRead(addr, nil)
+	balance := db.loadBalance(addr)
+	if db.proofs != nil {
+		db.recordFetchError(db.proofs.checkBalance(addr, balance))
+	}
+	if db.recorder != nil {
+		db.recorder.RecordBalance(addr, balance)
+	}
+	return balance
+}
+
+func (db *CachingStateDB) loadBalance(addr common.Address) *uint256.Int {
 	cacheKey := getBalanceCacheKey(addr)
 
 	// Try to get from cache first
@@ -142,9 +170,17 @@ func (db *CachingStateDB) GetBalance(addr common.Address) *uint256.Int {
 		return balance.(*uint256.Int)
 	}
 
-	// Fetch from RPC if not in cache
-	balance, err := db.client.BalanceAt(context.Background(), addr, db.blockNum)
+	// Try the persistent cache next
+	if value, ok := db.loadPersisted(cache.BalanceKey(addr)); ok {
+		balance := new(uint256.Int).SetBytes(value)
+		db.cache.Store(cacheKey, balance)
+		return balance
+	}
+
+	// Fetch from the state source if not in cache
+	balance, err := db.source.Balance(addr)
 	if err != nil {
+		db.recordFetchError(&FetchError{Kind: "balance", Address: addr, Err: err})
 		return uint256.NewInt(0)
 	}
 
@@ -152,11 +188,24 @@ func (db *CachingStateDB) GetBalance(addr common.Address) *uint256.Int {
 	balanceU256 := new(uint256.Int)
 	balanceU256.SetFromBig(balance)
 	db.cache.Store(cacheKey, balanceU256)
+	db.persist(cache.BalanceKey(addr), balanceU256.Bytes())
 	return balanceU256
 }
 
 // GetCode fetches the code for a contract address, using cache if available
 func (db *CachingStateDB) GetCode(addr common.Address) []byte {
+	db.recordRead(addr, nil)
+	code := db.loadCode(addr)
+	if db.proofs != nil {
+		db.recordFetchError(db.proofs.checkCode(addr, code))
+	}
+	if db.recorder != nil {
+		db.recorder.RecordCode(addr, code)
+	}
+	return code
+}
+
+func (db *CachingStateDB) loadCode(addr common.Address) []byte {
 	cacheKey := getCodeCacheKey(addr)
 
 	// Try to get from cache first
@@ -164,19 +213,39 @@ func (db *CachingStateDB) GetCode(addr common.Address) []byte {
 		return code.([]byte)
 	}
 
-	// Fetch from RPC if not in cache
-	code, err := db.client.CodeAt(context.Background(), addr, db.blockNum)
+	// Try the persistent cache next
+	if code, ok := db.loadPersisted(cache.CodeKey(addr)); ok {
+		db.cache.Store(cacheKey, code)
+		return code
+	}
+
+	// Fetch from the state source if not in cache
+	code, err := db.source.Code(addr)
 	if err != nil {
+		db.recordFetchError(&FetchError{Kind: "code", Address: addr, Err: err})
 		return nil
 	}
 
 	// Store in cache
 	db.cache.Store(cacheKey, code)
+	db.persist(cache.CodeKey(addr), code)
 	return code
 }
 
 // GetState fetches storage value for an address at a specific key, using cache if available
 func (db *CachingStateDB) GetState(addr common.Address, key common.Hash) common.Hash {
+	db.recordRead(addr, &key)
+	value := db.loadState(addr, key)
+	if db.proofs != nil && !db.storageReplaced[addr] {
+		db.recordFetchError(db.proofs.checkStorage(addr, key, value))
+	}
+	if db.recorder != nil && !db.storageReplaced[addr] {
+		db.recorder.RecordStorage(addr, key, value)
+	}
+	return value
+}
+
+func (db *CachingStateDB) loadState(addr common.Address, key common.Hash) common.Hash {
 	// Create a composite key for storage
 	storageKey := getStorageCacheKey(addr, key)
 
@@ -185,20 +254,44 @@ func (db *CachingStateDB) GetState(addr common.Address, key common.Hash) common.
 		return value.(common.Hash)
 	}
 
-	// Fetch from RPC if not in cache
-	value, err := db.client.StorageAt(context.Background(), addr, key, db.blockNum)
+	// Storage replaced by an override reads as zero unless explicitly set
+	if db.storageReplaced[addr] {
+		return common.Hash{}
+	}
+
+	// Try the persistent cache next
+	if value, ok := db.loadPersisted(cache.StorageKey(addr, key)); ok {
+		db.cache.Store(storageKey, common.BytesToHash(value))
+		return common.BytesToHash(value)
+	}
+
+	// Fetch from the state source if not in cache
+	value, err := db.source.Storage(addr, key)
 	if err != nil {
-		fmt.Println("ERROR FROM GET STATE!!!!!", err)
+		db.recordFetchError(&FetchError{Kind: "storage", Address: addr, Slot: &key, Err: err})
 		return common.Hash{}
 	}
 
 	// Store in cache
-	db.cache.Store(storageKey, common.BytesToHash(value))
-	return common.BytesToHash(value)
+	db.cache.Store(storageKey, value)
+	db.persist(cache.StorageKey(addr, key), value.Bytes())
+	return value
 }
 
 // GetNonce fetches the nonce for an address, using cache if available
 func (db *CachingStateDB) GetNonce(addr common.Address) uint64 {
+	db.recordRead(addr, nil)
+	nonce := db.loadNonce(addr)
+	if db.proofs != nil {
+		db.recordFetchError(db.proofs.checkNonce(addr, nonce))
+	}
+	if db.recorder != nil {
+		db.recorder.RecordNonce(addr, nonce)
+	}
+	return nonce
+}
+
+func (db *CachingStateDB) loadNonce(addr common.Address) uint64 {
 	cacheKey := getNonceCacheKey(addr)
 
 	// Try to get from cache first
@@ -206,51 +299,94 @@ func (db *CachingStateDB) GetNonce(addr common.Address) uint64 {
 		return nonce.(uint64)
 	}
 
-	// Fetch from RPC if not in cache
-	nonce, err := db.client.NonceAt(context.Background(), addr, db.blockNum)
+	// Try the persistent cache next
+	if value, ok := db.loadPersisted(cache.NonceKey(addr)); ok && len(value) == 8 {
+		nonce := binary.BigEndian.Uint64(value)
+		db.cache.Store(cacheKey, nonce)
+		return nonce
+	}
+
+	// Fetch from the state source if not in cache
+	nonce, err := db.source.Nonce(addr)
 	if err != nil {
+		db.recordFetchError(&FetchError{Kind: "nonce", Address: addr, Err: err})
 		return 0
 	}
 
 	// Store in cache
 	db.cache.Store(cacheKey, nonce)
+	db.persist(cache.NonceKey(addr), binary.BigEndian.AppendUint64(nil, nonce))
 	return nonce
 }
 
-func (db *CachingStateDB) SubBalance(addr common.Address, amount *uint256.Int, _ tracing.BalanceChangeReason) uint256.Int {
-	stateDiff := db.getStateDiff(addr)
+// loadPersisted reads state fetched by a previous run from the on-disk cache
+func (db *CachingStateDB) loadPersisted(key []byte) ([]byte, bool) {
+	value, err := db.db.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
 
-	balanceBefore := db.GetBalance(addr)
-	if stateDiff.BalanceBefore == nil {
-		stateDiff.BalanceBefore = balanceBefore
+// persist saves state fetched from the RPC so later runs against the same
+// chain and block can skip the request
+func (db *CachingStateDB) persist(key, value []byte) {
+	if err := db.db.Put(key, value); err != nil && DEBUG_LOGGING {
+		fmt.Println("Error persisting state to cache:", err)
 	}
+}
+
+// Close releases the underlying database, flushing the persistent cache
+func (db *CachingStateDB) Close() error {
+	return db.db.Close()
+}
 
-	if stateDiff.BalanceAfter == nil {
-		stateDiff.BalanceAfter = new(uint256.Int)
+func (db *CachingStateDB) recordFetchError(err error) {
+	if err == nil {
+		return
+	}
+	if DEBUG_LOGGING {
+		fmt.Println(err)
 	}
-	stateDiff.BalanceAfter.Sub(balanceBefore, amount)
+	db.fetchErrors = append(db.fetchErrors, err)
+}
 
-	db.diffs[addr] = stateDiff
-	db.cache.Store(getBalanceCacheKey(addr), stateDiff.BalanceAfter)
-	return *balanceBefore
+// Error returns every state fetch or proof verification error that occurred,
+// or nil if the state used by the simulation was fetched successfully
+func (db *CachingStateDB) Error() error {
+	return errors.Join(db.fetchErrors...)
+}
+
+func (db *CachingStateDB) SubBalance(addr common.Address, amount *uint256.Int, _ tracing.BalanceChangeReason) uint256.Int {
+	balanceBefore := *db.GetBalance(addr)
+	db.setBalance(addr, new(uint256.Int).Sub(&balanceBefore, amount))
+	return balanceBefore
 }
 
 func (db *CachingStateDB) AddBalance(addr common.Address, amount *uint256.Int, _ tracing.BalanceChangeReason) uint256.Int {
+	balanceBefore := *db.GetBalance(addr)
+	db.setBalance(addr, new(uint256.Int).Add(&balanceBefore, amount))
+	return balanceBefore
+}
+
+func (db *CachingStateDB) setBalance(addr common.Address, balance *uint256.Int) {
 	stateDiff := db.getStateDiff(addr)
 
 	balanceBefore := db.GetBalance(addr)
+	db.journal.append(balanceChange{
+		account:    addr,
+		prev:       balanceBefore,
+		prevBefore: stateDiff.BalanceBefore,
+		prevAfter:  stateDiff.BalanceAfter,
+	})
+
 	if stateDiff.BalanceBefore == nil {
 		stateDiff.BalanceBefore = balanceBefore
 	}
-
-	if stateDiff.BalanceAfter == nil {
-		stateDiff.BalanceAfter = new(uint256.Int)
-	}
-	stateDiff.BalanceAfter.Add(balanceBefore, amount)
+	stateDiff.BalanceAfter = balance
 
 	db.diffs[addr] = stateDiff
-	db.cache.Store(getBalanceCacheKey(addr), stateDiff.BalanceAfter)
-	return *balanceBefore
+	db.cache.Store(getBalanceCacheKey(addr), balance)
 }
 
 func (db *CachingStateDB) SetState(addr common.Address, key, value common.Hash) common.Hash {
@@ -262,6 +398,14 @@ func (db *CachingStateDB) setState(addr common.Address, key, value common.Hash,
 	storageDiff := stateDiff.getStorageDiff(key)
 
 	valueBefore := db.GetState(addr, key)
+	db.journal.append(storageChange{
+		account:  addr,
+		key:      key,
+		prev:     valueBefore,
+		prevDiff: storageDiff,
+		hadDiff:  storageDiff.isSet,
+	})
+
 	if isOverride {
 		valueBefore = value
 	}
@@ -284,6 +428,14 @@ func (db *CachingStateDB) SetNonce(addr common.Address, nonce uint64, _ tracing.
 	stateDiff := db.getStateDiff(addr)
 
 	nonceBefore := db.GetNonce(addr)
+	db.journal.append(nonceChange{
+		account:    addr,
+		prev:       nonceBefore,
+		prevSeen:   stateDiff.NonceSeen,
+		prevBefore: stateDiff.NonceBefore,
+		prevAfter:  stateDiff.NonceAfter,
+	})
+
 	if !stateDiff.NonceSeen {
 		stateDiff.NonceBefore = nonceBefore
 		stateDiff.NonceSeen = true
@@ -330,6 +482,20 @@ func (db *CachingStateDB) getStateDiff(addr common.Address) StateDiff {
 	return stateDiff
 }
 
+// putStateDiff stores the diff for an address, dropping it once a revert has
+// left nothing to report
+func (db *CachingStateDB) putStateDiff(stateDiff StateDiff) {
+	if stateDiff.isEmpty() {
+		delete(db.diffs, stateDiff.Address)
+		return
+	}
+	db.diffs[stateDiff.Address] = stateDiff
+}
+
+func (diff *StateDiff) isEmpty() bool {
+	return diff.BalanceBefore == nil && !diff.NonceSeen && !diff.CodeSeen && !diff.Created && len(diff.StorageDiffs) == 0
+}
+
 func (diff *StateDiff) getStorageDiff(key common.Hash) StorageDiff {
 	storageDiff, ok := diff.StorageDiffs[key]
 	if !ok {
@@ -347,12 +513,16 @@ func (db *CachingStateDB) AddPreimage(hash common.Hash, preimage []byte) {
 
 func (db *CachingStateDB) GetCodeHash(addr common.Address) common.Hash {
 	// Retrieve code from cache or RPC
-	code := db.GetCode(addr)
+	return codeHash(db.GetCode(addr))
+}
+
+func codeHash(code []byte) common.Hash {
 	if len(code) == 0 {
 		return common.Hash{}
 	}
 	return crypto.Keccak256Hash(code)
 }
+
 func (db *CachingStateDB) GetCodeSize(addr common.Address) int {
 	code := db.GetCode(addr)
 	return len(code)
@@ -363,6 +533,10 @@ func (db *CachingStateDB) AddAddressToAccessList(addr common.Address) {
 	if DEBUG_LOGGING {
 		fmt.Println("AddAddressToAccessList", addr)
 	}
+
+	if db.accessList.AddAddress(addr) {
+		db.journal.append(accessListAddAccountChange{address: addr})
+	}
 }
 
 // AddSlotToAccessList adds a slot to the access list
@@ -370,6 +544,14 @@ func (db *CachingStateDB) AddSlotToAccessList(addr common.Address, slot common.H
 	if DEBUG_LOGGING {
 		fmt.Println("AddSlotToAccessList", addr, slot)
 	}
+
+	addrChange, slotChange := db.accessList.AddSlot(addr, slot)
+	if addrChange {
+		db.journal.append(accessListAddAccountChange{address: addr})
+	}
+	if slotChange {
+		db.journal.append(accessListAddSlotChange{address: addr, slot: slot})
+	}
 }
 
 // AddressInAccessList checks if an address is in the access list
@@ -377,7 +559,7 @@ func (db *CachingStateDB) AddressInAccessList(addr common.Address) bool {
 	if DEBUG_LOGGING {
 		fmt.Println("AddressInAccessList", addr)
 	}
-	return true
+	return db.accessList.ContainsAddress(addr)
 }
 
 // GetTransientState gets the transient state for an address and key
@@ -385,7 +567,7 @@ func (db *CachingStateDB) GetTransientState(addr common.Address, key common.Hash
 	if DEBUG_LOGGING {
 		fmt.Println("GetTransientState", addr, key)
 	}
-	return common.Hash{}
+	return db.transientStorage.Get(addr, key)
 }
 
 // Prepare prepares the state database for a new transaction
@@ -393,6 +575,33 @@ func (db *CachingStateDB) Prepare(rules params.Rules, sender, coinbase common.Ad
 	if DEBUG_LOGGING {
 		fmt.Println("Prepare")
 	}
+
+	// Mirror the EIP-2929 pre-warming done by geth's state.StateDB
+	db.accessList = newAccessList()
+	if rules.IsEIP2929 {
+		db.accessList.AddAddress(sender)
+		if dest != nil {
+			db.accessList.AddAddress(*dest)
+		}
+		for _, addr := range precompiles {
+			db.accessList.AddAddress(addr)
+		}
+		for _, el := range txAccesses {
+			db.accessList.AddAddress(el.Address)
+			for _, key := range el.StorageKeys {
+				db.accessList.AddSlot(el.Address, key)
+			}
+		}
+		// EIP-3651: warm coinbase
+		if rules.IsShanghai {
+			db.accessList.AddAddress(coinbase)
+		}
+	}
+	db.refund = 0
+
+	// Transient storage only lives for the duration of a single transaction
+	db.transientStorage = newTransientStorage()
+	db.transientWrites = nil
 }
 
 // Selfdestruct6780 implements the EIP-6780 selfdestruct behavior
@@ -408,6 +617,22 @@ func (db *CachingStateDB) SetTransientState(addr common.Address, key, value comm
 	if DEBUG_LOGGING {
 		fmt.Println("SetTransientState", addr, key, value)
 	}
+
+	prev := db.transientStorage.Get(addr, key)
+	db.journal.append(transientStorageChange{
+		account: addr,
+		key:     key,
+		prev:    prev,
+	})
+
+	db.transientStorage.Set(addr, key, value)
+	db.transientWrites = append(db.transientWrites, TransientWrite{Address: addr, Key: key, Value: value})
+}
+
+// GetTransientWrites returns every transient storage write that was not
+// reverted, in execution order
+func (db *CachingStateDB) GetTransientWrites() []TransientWrite {
+	return db.transientWrites
 }
 
 // SlotInAccessList checks if a slot is in the access list
@@ -415,7 +640,7 @@ func (db *CachingStateDB) SlotInAccessList(addr common.Address, slot common.Hash
 	if DEBUG_LOGGING {
 		fmt.Println("SlotInAccessList", addr, slot)
 	}
-	return true, true
+	return db.accessList.Contains(addr, slot)
 }
 
 // Required vm.StateDB interface methods that we don't need to implement for simulation
@@ -428,29 +653,67 @@ func (db *CachingStateDB) GetRefund() uint64 {
 	if DEBUG_LOGGING {
 		fmt.Println("GetRefund")
 	}
-	return 0
+	return db.refund
 }
 func (db *CachingStateDB) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
 	if DEBUG_LOGGING {
 		fmt.Printf("GetCommittedState(%s, %s)\n", addr, key)
 	}
-	return common.Hash{}
+
+	// The value before the first write of the transaction is the committed
+	// value, with overrides treated as part of the pre-state
+	if storageDiff, ok := db.diffs[addr].StorageDiffs[key]; ok {
+		return storageDiff.ValueBefore
+	}
+	return db.GetState(addr, key)
 }
-func (db *CachingStateDB) SetCode(common.Address, []byte) []byte {
+
+// SetCode stores the deployed code and tracks the code hash change
+func (db *CachingStateDB) SetCode(addr common.Address, code []byte) []byte {
 	if DEBUG_LOGGING {
-		fmt.Println("SetCode")
+		fmt.Println("SetCode", addr)
 	}
-	return nil
+
+	stateDiff := db.getStateDiff(addr)
+
+	prev := db.GetCode(addr)
+	db.journal.append(codeChange{
+		account:    addr,
+		prev:       prev,
+		prevSeen:   stateDiff.CodeSeen,
+		prevBefore: stateDiff.CodeHashBefore,
+		prevAfter:  stateDiff.CodeHashAfter,
+	})
+
+	if !stateDiff.CodeSeen {
+		stateDiff.CodeHashBefore = db.GetCodeHash(addr)
+		stateDiff.CodeSeen = true
+	}
+	stateDiff.CodeHashAfter = codeHash(code)
+
+	db.diffs[addr] = stateDiff
+	db.cache.Store(getCodeCacheKey(addr), code)
+	return prev
 }
+
 func (db *CachingStateDB) AddRefund(amt uint64) {
 	if DEBUG_LOGGING {
 		fmt.Println("AddRefund", amt)
 	}
+
+	db.journal.append(refundChange{prev: db.refund})
+	db.refund += amt
 }
 func (db *CachingStateDB) SubRefund(amt uint64) {
 	if DEBUG_LOGGING {
 		fmt.Println("SubRefund", amt)
 	}
+
+	db.journal.append(refundChange{prev: db.refund})
+	if amt > db.refund {
+		panic(fmt.Sprintf("Refund counter below zero (gas: %d > refund: %d)", amt, db.refund))
+	}
+	db.refund -= amt
 }
 func (db *CachingStateDB) SelfDestruct(addr common.Address) uint256.Int {
 	if DEBUG_LOGGING {
@@ -468,29 +731,65 @@ func (db *CachingStateDB) Exist(addr common.Address) bool {
 	if DEBUG_LOGGING {
 		fmt.Println("Exist", addr)
 	}
-	return true
+
+	// Accounts touched by the simulation exist even when they are empty
+	_, touched := db.diffs[addr]
+	return touched || !db.Empty(addr)
 }
 func (db *CachingStateDB) Empty(addr common.Address) bool {
 	if DEBUG_LOGGING {
 		fmt.Println("Empty", addr)
 	}
-	return false
+
+	// EIP-161: an account is empty when it has no nonce, balance or code
+	return db.GetNonce(addr) == 0 && db.GetBalance(addr).IsZero() && db.GetCodeSize(addr) == 0
 }
-func (db *CachingStateDB) RevertToSnapshot(amt int) {
+
+// RevertToSnapshot undoes every write made since the given snapshot was taken
+func (db *CachingStateDB) RevertToSnapshot(revid int) {
 	if DEBUG_LOGGING {
-		fmt.Println("RevertToSnapshot", amt)
+		fmt.Println("RevertToSnapshot", revid)
 	}
+	db.journal.revertToSnapshot(revid, db)
 }
+
+// Snapshot returns an identifier for the current revision of the state
 func (db *CachingStateDB) Snapshot() int {
 	if DEBUG_LOGGING {
 		fmt.Println("Snapshot")
 	}
-	return 0
+	return db.journal.snapshot()
 }
-func (db *CachingStateDB) AddLog(*types.Log) {
+
+func (db *CachingStateDB) AddLog(log *types.Log) {
 	if DEBUG_LOGGING {
 		fmt.Println("AddLog")
 	}
+
+	db.journal.append(logChange{})
+	log.Index = uint(len(db.logs))
+	db.logs = append(db.logs, Log{Log: *log, Depth: db.callDepth})
+}
+
+// GetLogs returns the logs emitted by frames that were not reverted, in order
+func (db *CachingStateDB) GetLogs() []Log {
+	return db.logs
+}
+
+// Hooks returns the tracing hooks the EVM must be configured with so that the
+// state database can attribute logs to the call depth that emitted them
+func (db *CachingStateDB) Hooks() *tracing.Hooks {
+	return &tracing.Hooks{
+		OnEnter: func(depth int, typ byte, from, _ common.Address, _ []byte, _ uint64, _ *big.Int) {
+			db.callDepth = depth
+			if vm.OpCode(typ) == vm.CREATE || vm.OpCode(typ) == vm.CREATE2 {
+				db.deployer = from
+			}
+		},
+		OnExit: func(depth int, _ []byte, _ uint64, _ error, _ bool) {
+			db.callDepth = depth - 1
+		},
+	}
 }
 
 func (db *CachingStateDB) AccessEvents() *state.AccessEvents {
@@ -500,16 +799,31 @@ func (db *CachingStateDB) AccessEvents() *state.AccessEvents {
 	return nil
 }
 
+// CreateContract marks the address as deployed during the simulation by the
+// creator of the current CREATE/CREATE2 frame
 func (db *CachingStateDB) CreateContract(addr common.Address) {
 	if DEBUG_LOGGING {
 		fmt.Println("CreateContract", addr)
 	}
+
+	stateDiff := db.getStateDiff(addr)
+	db.journal.append(createContractChange{
+		account:      addr,
+		prevCreated:  stateDiff.Created,
+		prevDeployer: stateDiff.Deployer,
+	})
+
+	stateDiff.Created = true
+	stateDiff.Deployer = db.deployer
+	db.diffs[addr] = stateDiff
 }
 
 func (db *CachingStateDB) Finalise(deleteEmptyObjects bool) {
 	if DEBUG_LOGGING {
 		fmt.Println("Finalise")
 	}
+	db.journal.reset()
+	db.refund = 0
 }
 
 func (db *CachingStateDB) GetStorageRoot(addr common.Address) common.Hash {
@@ -0,0 +1,44 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// FetchError is recorded when a piece of state could not be fetched from the
+// RPC. The simulation result can't be trusted once one has occurred, since the
+// EVM continued with a zero value in place of the real state.
+type FetchError struct {
+	Kind    string
+	Address common.Address
+	Slot    *common.Hash
+	Err     error
+}
+
+func (e *FetchError) Error() string {
+	if e.Slot != nil {
+		return fmt.Sprintf("failed to fetch %s of %s at slot %s: %v", e.Kind, e.Address.Hex(), e.Slot.Hex(), e.Err)
+	}
+	return fmt.Sprintf("failed to fetch %s of %s: %v", e.Kind, e.Address.Hex(), e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// ProofError is recorded when state returned by the RPC does not match the
+// eth_getProof Merkle proof against the pinned block's state root
+type ProofError struct {
+	Kind    string
+	Address common.Address
+	Slot    *common.Hash
+	Reason  string
+}
+
+func (e *ProofError) Error() string {
+	if e.Slot != nil {
+		return fmt.Sprintf("proof verification failed for %s of %s at slot %s: %s", e.Kind, e.Address.Hex(), e.Slot.Hex(), e.Reason)
+	}
+	return fmt.Sprintf("proof verification failed for %s of %s: %s", e.Kind, e.Address.Hex(), e.Reason)
+}
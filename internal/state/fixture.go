@@ -0,0 +1,15 @@
+package state
+
+import "github.com/jackchuma/state-diff/internal/fixture"
+
+// SetRecorder records the pre-state of everything the simulation reads into
+// the bundle
+func (db *CachingStateDB) SetRecorder(bundle *fixture.Bundle) {
+	db.recorder = bundle
+}
+
+// RecordFetchError records an error fetching state read outside the state
+// database, such as the block headers used by BLOCKHASH
+func (db *CachingStateDB) RecordFetchError(err error) {
+	db.recordFetchError(err)
+}
@@ -0,0 +1,192 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// journalEntry is a modification that can be undone when the EVM reverts a frame
+type journalEntry interface {
+	revert(db *CachingStateDB)
+}
+
+type revision struct {
+	id           int
+	journalIndex int
+}
+
+// journal records every write made to the CachingStateDB so that Snapshot and
+// RevertToSnapshot can roll back both the cached values and the recorded diffs
+type journal struct {
+	entries        []journalEntry
+	validRevisions []revision
+	nextRevisionID int
+}
+
+func newJournal() *journal {
+	return &journal{}
+}
+
+func (j *journal) append(entry journalEntry) {
+	j.entries = append(j.entries, entry)
+}
+
+func (j *journal) snapshot() int {
+	id := j.nextRevisionID
+	j.nextRevisionID++
+	j.validRevisions = append(j.validRevisions, revision{id: id, journalIndex: len(j.entries)})
+	return id
+}
+
+func (j *journal) revertToSnapshot(revid int, db *CachingStateDB) {
+	idx := sort.Search(len(j.validRevisions), func(i int) bool {
+		return j.validRevisions[i].id >= revid
+	})
+	if idx == len(j.validRevisions) || j.validRevisions[idx].id != revid {
+		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+	}
+	index := j.validRevisions[idx].journalIndex
+
+	// Undo the changes in reverse order and drop the invalidated revisions
+	for i := len(j.entries) - 1; i >= index; i-- {
+		j.entries[i].revert(db)
+	}
+	j.entries = j.entries[:index]
+	j.validRevisions = j.validRevisions[:idx]
+}
+
+func (j *journal) reset() {
+	j.entries = j.entries[:0]
+	j.validRevisions = j.validRevisions[:0]
+	j.nextRevisionID = 0
+}
+
+type balanceChange struct {
+	account    common.Address
+	prev       *uint256.Int
+	prevBefore *uint256.Int
+	prevAfter  *uint256.Int
+}
+
+type nonceChange struct {
+	account    common.Address
+	prev       uint64
+	prevSeen   bool
+	prevBefore uint64
+	prevAfter  uint64
+}
+
+type storageChange struct {
+	account  common.Address
+	key      common.Hash
+	prev     common.Hash
+	prevDiff StorageDiff
+	hadDiff  bool
+}
+
+type transientStorageChange struct {
+	account common.Address
+	key     common.Hash
+	prev    common.Hash
+}
+
+type logChange struct{}
+
+type refundChange struct {
+	prev uint64
+}
+
+type accessListAddAccountChange struct {
+	address common.Address
+}
+
+type accessListAddSlotChange struct {
+	address common.Address
+	slot    common.Hash
+}
+
+type codeChange struct {
+	account    common.Address
+	prev       []byte
+	prevSeen   bool
+	prevBefore common.Hash
+	prevAfter  common.Hash
+}
+
+type createContractChange struct {
+	account      common.Address
+	prevCreated  bool
+	prevDeployer common.Address
+}
+
+func (ch balanceChange) revert(db *CachingStateDB) {
+	db.cache.Store(getBalanceCacheKey(ch.account), ch.prev)
+
+	stateDiff := db.getStateDiff(ch.account)
+	stateDiff.BalanceBefore = ch.prevBefore
+	stateDiff.BalanceAfter = ch.prevAfter
+	db.putStateDiff(stateDiff)
+}
+
+func (ch nonceChange) revert(db *CachingStateDB) {
+	db.cache.Store(getNonceCacheKey(ch.account), ch.prev)
+
+	stateDiff := db.getStateDiff(ch.account)
+	stateDiff.NonceSeen = ch.prevSeen
+	stateDiff.NonceBefore = ch.prevBefore
+	stateDiff.NonceAfter = ch.prevAfter
+	db.putStateDiff(stateDiff)
+}
+
+func (ch storageChange) revert(db *CachingStateDB) {
+	db.cache.Store(getStorageCacheKey(ch.account, ch.key), ch.prev)
+
+	stateDiff := db.getStateDiff(ch.account)
+	if ch.hadDiff {
+		stateDiff.StorageDiffs[ch.key] = ch.prevDiff
+	} else {
+		delete(stateDiff.StorageDiffs, ch.key)
+	}
+	db.putStateDiff(stateDiff)
+}
+
+func (ch transientStorageChange) revert(db *CachingStateDB) {
+	db.transientStorage.Set(ch.account, ch.key, ch.prev)
+	db.transientWrites = db.transientWrites[:len(db.transientWrites)-1]
+}
+
+func (ch logChange) revert(db *CachingStateDB) {
+	db.logs = db.logs[:len(db.logs)-1]
+}
+
+func (ch codeChange) revert(db *CachingStateDB) {
+	db.cache.Store(getCodeCacheKey(ch.account), ch.prev)
+
+	stateDiff := db.getStateDiff(ch.account)
+	stateDiff.CodeSeen = ch.prevSeen
+	stateDiff.CodeHashBefore = ch.prevBefore
+	stateDiff.CodeHashAfter = ch.prevAfter
+	db.putStateDiff(stateDiff)
+}
+
+func (ch createContractChange) revert(db *CachingStateDB) {
+	stateDiff := db.getStateDiff(ch.account)
+	stateDiff.Created = ch.prevCreated
+	stateDiff.Deployer = ch.prevDeployer
+	db.putStateDiff(stateDiff)
+}
+
+func (ch refundChange) revert(db *CachingStateDB) {
+	db.refund = ch.prev
+}
+
+func (ch accessListAddAccountChange) revert(db *CachingStateDB) {
+	db.accessList.DeleteAddress(ch.address)
+}
+
+func (ch accessListAddSlotChange) revert(db *CachingStateDB) {
+	db.accessList.DeleteSlot(ch.address, ch.slot)
+}
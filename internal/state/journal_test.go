@@ -0,0 +1,148 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+var (
+	testAccount = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+	testSlot    = common.HexToHash("0x01")
+)
+
+func newTestStateDB(t *testing.T) *CachingStateDB {
+	t.Helper()
+
+	header := &types.Header{Number: big.NewInt(1)}
+	source := NewMemorySource(header, nil)
+	source.SetBalance(testAccount, big.NewInt(100))
+	source.SetNonce(testAccount, 5)
+	source.SetStorage(testAccount, testSlot, common.HexToHash("0x11"))
+
+	db := NewCachingStateDB(source, header, rawdb.NewMemoryDatabase()).(*CachingStateDB)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRevertToSnapshot(t *testing.T) {
+	tests := []struct {
+		name string
+		// kept is applied before the snapshot and must survive the revert
+		kept func(db *CachingStateDB)
+		// reverted is applied after the snapshot and must be undone
+		reverted func(db *CachingStateDB)
+		balance  uint64
+		nonce    uint64
+		storage  common.Hash
+		diffs    int
+	}{
+		{
+			name: "balance",
+			reverted: func(db *CachingStateDB) {
+				db.AddBalance(testAccount, uint256.NewInt(50), tracing.BalanceChangeUnspecified)
+				db.SubBalance(testAccount, uint256.NewInt(20), tracing.BalanceChangeUnspecified)
+			},
+			balance: 100, nonce: 5, storage: common.HexToHash("0x11"),
+		},
+		{
+			name: "nonce",
+			reverted: func(db *CachingStateDB) {
+				db.SetNonce(testAccount, 6, tracing.NonceChangeUnspecified)
+			},
+			balance: 100, nonce: 5, storage: common.HexToHash("0x11"),
+		},
+		{
+			name: "storage",
+			reverted: func(db *CachingStateDB) {
+				db.SetState(testAccount, testSlot, common.HexToHash("0x22"))
+				db.SetState(testAccount, testSlot, common.HexToHash("0x33"))
+			},
+			balance: 100, nonce: 5, storage: common.HexToHash("0x11"),
+		},
+		{
+			name: "all kinds",
+			reverted: func(db *CachingStateDB) {
+				db.AddBalance(testAccount, uint256.NewInt(1), tracing.BalanceChangeUnspecified)
+				db.SetNonce(testAccount, 7, tracing.NonceChangeUnspecified)
+				db.SetState(testAccount, testSlot, common.HexToHash("0x22"))
+				db.SetTransientState(testAccount, testSlot, common.HexToHash("0x44"))
+			},
+			balance: 100, nonce: 5, storage: common.HexToHash("0x11"),
+		},
+		{
+			name: "outer changes kept",
+			kept: func(db *CachingStateDB) {
+				db.SetState(testAccount, testSlot, common.HexToHash("0x22"))
+			},
+			reverted: func(db *CachingStateDB) {
+				db.SetState(testAccount, testSlot, common.HexToHash("0x33"))
+				db.AddBalance(testAccount, uint256.NewInt(1), tracing.BalanceChangeUnspecified)
+			},
+			balance: 100, nonce: 5, storage: common.HexToHash("0x22"), diffs: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestStateDB(t)
+			if test.kept != nil {
+				test.kept(db)
+			}
+
+			revid := db.Snapshot()
+			test.reverted(db)
+			db.RevertToSnapshot(revid)
+
+			if balance := db.GetBalance(testAccount); balance.Uint64() != test.balance {
+				t.Errorf("balance = %d, want %d", balance, test.balance)
+			}
+			if nonce := db.GetNonce(testAccount); nonce != test.nonce {
+				t.Errorf("nonce = %d, want %d", nonce, test.nonce)
+			}
+			if value := db.GetState(testAccount, testSlot); value != test.storage {
+				t.Errorf("storage = %s, want %s", value.Hex(), test.storage.Hex())
+			}
+			if value := db.GetTransientState(testAccount, testSlot); value != (common.Hash{}) {
+				t.Errorf("transient storage = %s, want zero", value.Hex())
+			}
+			if writes := db.GetTransientWrites(); len(writes) != 0 {
+				t.Errorf("got %d transient writes, want none", len(writes))
+			}
+			if diffs := db.GetStateDiffs(); len(diffs) != test.diffs {
+				t.Fatalf("got %d state diffs, want %d", len(diffs), test.diffs)
+			}
+		})
+	}
+}
+
+func TestRevertKeepsOuterDiff(t *testing.T) {
+	db := newTestStateDB(t)
+	db.SetState(testAccount, testSlot, common.HexToHash("0x22"))
+
+	revid := db.Snapshot()
+	db.SetState(testAccount, testSlot, common.HexToHash("0x33"))
+	db.SetNonce(testAccount, 6, tracing.NonceChangeUnspecified)
+	db.RevertToSnapshot(revid)
+
+	diffs := db.GetStateDiffs()
+	if len(diffs) != 1 {
+		t.Fatalf("got %d state diffs, want 1", len(diffs))
+	}
+	diff := diffs[0]
+	if diff.NonceSeen || diff.BalanceBefore != nil {
+		t.Errorf("reverted nonce or balance change is still in the diff")
+	}
+	storageDiff, ok := diff.StorageDiffs[testSlot]
+	if !ok {
+		t.Fatalf("storage diff of slot %s is missing", testSlot.Hex())
+	}
+	if storageDiff.ValueBefore != common.HexToHash("0x11") || storageDiff.ValueAfter != common.HexToHash("0x22") {
+		t.Errorf("storage diff = %s -> %s, want 0x11 -> 0x22", storageDiff.ValueBefore.Hex(), storageDiff.ValueAfter.Hex())
+	}
+}
@@ -0,0 +1,232 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MemorySource serves state from an in-memory world, built by hand or loaded
+// from a genesis alloc file
+type MemorySource struct {
+	accounts types.GenesisAlloc
+	headers  map[uint64]*types.Header
+	mu       sync.RWMutex
+}
+
+// NewMemorySource creates a source holding the given accounts, with header as
+// the block the simulation runs on
+func NewMemorySource(header *types.Header, accounts types.GenesisAlloc) *MemorySource {
+	if accounts == nil {
+		accounts = make(types.GenesisAlloc)
+	}
+	return &MemorySource{
+		accounts: accounts,
+		headers:  map[uint64]*types.Header{header.Number.Uint64(): header},
+	}
+}
+
+func (s *MemorySource) SetBalance(addr common.Address, balance *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := s.accounts[addr]
+	account.Balance = new(big.Int).Set(balance)
+	s.accounts[addr] = account
+}
+
+func (s *MemorySource) SetNonce(addr common.Address, nonce uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := s.accounts[addr]
+	account.Nonce = nonce
+	s.accounts[addr] = account
+}
+
+func (s *MemorySource) SetCode(addr common.Address, code []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := s.accounts[addr]
+	account.Code = common.CopyBytes(code)
+	s.accounts[addr] = account
+}
+
+func (s *MemorySource) SetStorage(addr common.Address, key, value common.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := s.accounts[addr]
+	if account.Storage == nil {
+		account.Storage = make(map[common.Hash]common.Hash)
+	}
+	account.Storage[key] = value
+	s.accounts[addr] = account
+}
+
+// AddHeader makes a header available to BLOCKHASH
+func (s *MemorySource) AddHeader(header *types.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.headers[header.Number.Uint64()] = header
+}
+
+func (s *MemorySource) Balance(addr common.Address) (*big.Int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if balance := s.accounts[addr].Balance; balance != nil {
+		return new(big.Int).Set(balance), nil
+	}
+	return new(big.Int), nil
+}
+
+func (s *MemorySource) Nonce(addr common.Address) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.accounts[addr].Nonce, nil
+}
+
+func (s *MemorySource) Code(addr common.Address) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return common.CopyBytes(s.accounts[addr].Code), nil
+}
+
+func (s *MemorySource) Storage(addr common.Address, key common.Hash) (common.Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.accounts[addr].Storage[key], nil
+}
+
+func (s *MemorySource) Header(number uint64) (*types.Header, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	header, ok := s.headers[number]
+	if !ok {
+		return nil, fmt.Errorf("no header for block %d in the in-memory state", number)
+	}
+	return header, nil
+}
+
+// allocFile covers the JSON files accepted by LoadAllocSource: a geth genesis
+// file (block fields plus "alloc"), an anvil state dump ("block" plus
+// "accounts"), or a bare alloc mapping addresses to accounts
+type allocFile struct {
+	Config *struct {
+		ChainID *big.Int `json:"chainId"`
+	} `json:"config"`
+	Alloc    types.GenesisAlloc `json:"alloc"`
+	Accounts types.GenesisAlloc `json:"accounts"`
+	Block    *allocBlock        `json:"block"`
+	allocBlock
+}
+
+type allocBlock struct {
+	Number        math.HexOrDecimal64   `json:"number"`
+	Timestamp     math.HexOrDecimal64   `json:"timestamp"`
+	GasLimit      math.HexOrDecimal64   `json:"gasLimit"`
+	AnvilGasLimit math.HexOrDecimal64   `json:"gas_limit"`
+	BaseFee       *math.HexOrDecimal256 `json:"baseFeePerGas"`
+	AnvilBaseFee  *math.HexOrDecimal256 `json:"basefee"`
+	Difficulty    *math.HexOrDecimal256 `json:"difficulty"`
+	Coinbase      common.Address        `json:"coinbase"`
+	MixHash       common.Hash           `json:"mixHash"`
+	PrevRandao    common.Hash           `json:"prevrandao"`
+	ExtraData     hexutil.Bytes         `json:"extraData"`
+	ExcessBlobGas *math.HexOrDecimal64  `json:"excessBlobGas"`
+}
+
+// DEFAULT_ALLOC_GAS_LIMIT is the block gas limit used when an alloc file does
+// not specify one
+var DEFAULT_ALLOC_GAS_LIMIT = uint64(30_000_000)
+
+// LoadAllocSource loads a genesis alloc file into a MemorySource. It returns
+// the header of the block to simulate on, built from the file's block fields,
+// and the chain ID from the genesis config (nil if the file has none).
+func LoadAllocSource(path string) (*MemorySource, *types.Header, *big.Int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading alloc file: %w", err)
+	}
+
+	var file allocFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, nil, fmt.Errorf("error parsing alloc file: %w", err)
+	}
+
+	block := &file.allocBlock
+	if file.Block != nil {
+		block = file.Block
+	}
+
+	accounts := file.Alloc
+	if accounts == nil {
+		accounts = file.Accounts
+	}
+	if accounts == nil {
+		// Neither a genesis file nor a state dump, so the whole file is the alloc
+		if err := json.Unmarshal(data, &accounts); err != nil {
+			return nil, nil, nil, fmt.Errorf("error parsing alloc file: expected a genesis file, an anvil state dump or an alloc: %w", err)
+		}
+		block = &allocBlock{}
+	}
+
+	header := block.header()
+	var chainID *big.Int
+	if file.Config != nil {
+		chainID = file.Config.ChainID
+	}
+
+	return NewMemorySource(header, accounts), header, chainID, nil
+}
+
+func (b *allocBlock) header() *types.Header {
+	header := &types.Header{
+		Number:     new(big.Int).SetUint64(uint64(b.Number)),
+		Time:       uint64(b.Timestamp),
+		GasLimit:   uint64(b.GasLimit),
+		Difficulty: new(big.Int),
+		Coinbase:   b.Coinbase,
+		MixDigest:  b.MixHash,
+		Extra:      b.ExtraData,
+		BaseFee:    new(big.Int),
+	}
+
+	if header.GasLimit == 0 {
+		header.GasLimit = uint64(b.AnvilGasLimit)
+	}
+	if header.GasLimit == 0 {
+		header.GasLimit = DEFAULT_ALLOC_GAS_LIMIT
+	}
+	if b.BaseFee != nil {
+		header.BaseFee = (*big.Int)(b.BaseFee)
+	} else if b.AnvilBaseFee != nil {
+		header.BaseFee = (*big.Int)(b.AnvilBaseFee)
+	}
+	if b.Difficulty != nil {
+		header.Difficulty = (*big.Int)(b.Difficulty)
+	}
+	if header.MixDigest == (common.Hash{}) {
+		header.MixDigest = b.PrevRandao
+	}
+	if b.ExcessBlobGas != nil {
+		excessBlobGas := uint64(*b.ExcessBlobGas)
+		header.ExcessBlobGas = &excessBlobGas
+	}
+
+	return header
+}
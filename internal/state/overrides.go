@@ -0,0 +1,199 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/holiman/uint256"
+)
+
+type StorageOverride struct {
+	Key   common.Hash `json:"key"`
+	Value common.Hash `json:"value"`
+}
+
+// Override replaces parts of an account's state before the simulation runs.
+// Storage and StateDiff patch individual slots on top of the fetched storage,
+// while State replaces the account's storage entirely, so every slot not listed
+// reads as zero. This follows the eth_call state override set.
+type Override struct {
+	ContractAddress common.Address              `json:"contractAddress"`
+	Balance         *hexutil.Big                `json:"balance,omitempty"`
+	Nonce           *hexutil.Uint64             `json:"nonce,omitempty"`
+	Code            *hexutil.Bytes              `json:"code,omitempty"`
+	Storage         []StorageOverride           `json:"storage"`
+	State           map[common.Hash]common.Hash `json:"state,omitempty"`
+	StateDiff       map[common.Hash]common.Hash `json:"stateDiff,omitempty"`
+}
+
+// ReplacesStorage returns true if the override replaces all of the account's storage
+func (o *Override) ReplacesStorage() bool {
+	return o.State != nil
+}
+
+// StorageOverrides returns every slot set by the override, sorted by key
+func (o *Override) StorageOverrides() []StorageOverride {
+	slots := make(map[common.Hash]common.Hash)
+	for _, storageOverride := range o.Storage {
+		slots[storageOverride.Key] = storageOverride.Value
+	}
+	for key, value := range o.StateDiff {
+		slots[key] = value
+	}
+	for key, value := range o.State {
+		slots[key] = value
+	}
+
+	result := make([]StorageOverride, 0, len(slots))
+	for key, value := range slots {
+		result = append(result, StorageOverride{Key: key, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Key[:], result[j].Key[:]) < 0
+	})
+	return result
+}
+
+func (o *Override) validate() error {
+	if o.ContractAddress == (common.Address{}) {
+		return errors.New("missing contractAddress")
+	}
+	if o.State != nil && (len(o.Storage) > 0 || len(o.StateDiff) > 0) {
+		return fmt.Errorf("%s: state cannot be combined with storage or stateDiff", o.ContractAddress.Hex())
+	}
+	if o.Balance != nil && o.Balance.ToInt().Sign() < 0 {
+		return fmt.Errorf("%s: balance cannot be negative", o.ContractAddress.Hex())
+	}
+	if o.Balance != nil && o.Balance.ToInt().BitLen() > 256 {
+		return fmt.Errorf("%s: balance does not fit in 256 bits", o.ContractAddress.Hex())
+	}
+	return nil
+}
+
+// SetOverrides decodes the overrides JSON and applies it on top of the fetched
+// state. An empty string applies no overrides.
+func (db *CachingStateDB) SetOverrides(overrides string) error {
+	if strings.TrimSpace(overrides) == "" {
+		return nil
+	}
+
+	var decodedOverrides []Override
+	decoder := json.NewDecoder(strings.NewReader(overrides))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&decodedOverrides); err != nil {
+		return fmt.Errorf("error decoding overrides JSON: %w", err)
+	}
+	if decoder.More() {
+		return errors.New("error decoding overrides JSON: unexpected data after the overrides list")
+	}
+
+	seen := make(map[common.Address]bool)
+	for i := range decodedOverrides {
+		if err := decodedOverrides[i].validate(); err != nil {
+			return fmt.Errorf("invalid override %d: %w", i, err)
+		}
+		if seen[decodedOverrides[i].ContractAddress] {
+			return fmt.Errorf("invalid override %d: %s is overridden more than once", i, decodedOverrides[i].ContractAddress.Hex())
+		}
+		seen[decodedOverrides[i].ContractAddress] = true
+	}
+
+	db.applyOverrides(decodedOverrides)
+	return nil
+}
+
+// AddOverrides applies more overrides on top of those already set, such as
+// generated ones. Storage can be added to an account that is already
+// overridden, but slots it already sets are kept so that explicit overrides take
+// precedence.
+func (db *CachingStateDB) AddOverrides(overrides []Override) error {
+	for i, override := range overrides {
+		if err := override.validate(); err != nil {
+			return fmt.Errorf("invalid override %d: %w", i, err)
+		}
+
+		existing := db.findOverride(override.ContractAddress)
+		if existing == nil {
+			db.Overrides = append(db.Overrides, override)
+			db.applyOverride(override)
+			continue
+		}
+
+		if override.Balance != nil || override.Nonce != nil || override.Code != nil || override.ReplacesStorage() {
+			return fmt.Errorf("invalid override %d: %s is already overridden, only storage can be added", i, override.ContractAddress.Hex())
+		}
+
+		set := make(map[common.Hash]bool)
+		for _, storageOverride := range existing.StorageOverrides() {
+			set[storageOverride.Key] = true
+		}
+		for _, storageOverride := range override.StorageOverrides() {
+			if set[storageOverride.Key] {
+				continue
+			}
+			if existing.ReplacesStorage() {
+				existing.State[storageOverride.Key] = storageOverride.Value
+			} else {
+				existing.Storage = append(existing.Storage, storageOverride)
+			}
+			db.setState(existing.ContractAddress, storageOverride.Key, storageOverride.Value, true)
+		}
+	}
+	return nil
+}
+
+func (db *CachingStateDB) findOverride(addr common.Address) *Override {
+	for i := range db.Overrides {
+		if db.Overrides[i].ContractAddress == addr {
+			return &db.Overrides[i]
+		}
+	}
+	return nil
+}
+
+func (db *CachingStateDB) GetOverrides() []Override {
+	return db.Overrides
+}
+
+// applyOverrides writes the overrides into the cache as if they were the fetched
+// state, so they are not reported as changes made by the simulation. Each value
+// is read first so that the real pre-state is still fetched (and verified when
+// proofs are enabled).
+func (db *CachingStateDB) applyOverrides(overrides []Override) {
+	db.Overrides = overrides
+
+	for _, override := range overrides {
+		db.applyOverride(override)
+	}
+}
+
+func (db *CachingStateDB) applyOverride(override Override) {
+	addr := override.ContractAddress
+
+	if override.Balance != nil {
+		db.GetBalance(addr)
+		balance, _ := uint256.FromBig(override.Balance.ToInt())
+		db.cache.Store(getBalanceCacheKey(addr), balance)
+	}
+	if override.Nonce != nil {
+		db.GetNonce(addr)
+		db.cache.Store(getNonceCacheKey(addr), uint64(*override.Nonce))
+	}
+	if override.Code != nil {
+		db.GetCode(addr)
+		db.cache.Store(getCodeCacheKey(addr), []byte(*override.Code))
+	}
+	if override.ReplacesStorage() {
+		db.storageReplaced[addr] = true
+	}
+
+	for _, storageOverride := range override.StorageOverrides() {
+		db.setState(addr, storageOverride.Key, storageOverride.Value, true)
+	}
+}
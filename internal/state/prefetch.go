@@ -0,0 +1,235 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/holiman/uint256"
+	"github.com/jackchuma/state-diff/internal/cache"
+)
+
+var PREFETCH_BATCH_SIZE = 100
+var PREFETCH_CONCURRENCY = 8
+
+// prefetchRequest is a single JSON-RPC call in a prefetch batch along with how
+// to store its result
+type prefetchRequest struct {
+	elem  rpc.BatchElem
+	store func()
+}
+
+// Prefetch warms the cache for every account and slot in the list using
+// batched JSON-RPC requests sent in parallel. Entries that are already cached,
+// in memory or on disk, are skipped, and failed entries are left for the
+// regular lazy fetch (which records the error) so a prefetch failure never
+// hides a real fetch error.
+// Only RPC sources are prefetched, other sources are already local.
+func (db *CachingStateDB) Prefetch(list types.AccessList) error {
+	source, ok := db.source.(*RPCSource)
+	if !ok {
+		return nil
+	}
+
+	requests := make([]prefetchRequest, 0)
+	for _, tuple := range list {
+		requests = append(requests, db.accountRequests(tuple.Address, source.BlockArg())...)
+		for _, key := range tuple.StorageKeys {
+			if req, ok := db.storageRequest(tuple.Address, key, source.BlockArg()); ok {
+				requests = append(requests, req)
+			}
+		}
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		batchErr error
+		sem      = make(chan struct{}, PREFETCH_CONCURRENCY)
+	)
+	for start := 0; start < len(requests); start += PREFETCH_BATCH_SIZE {
+		end := min(start+PREFETCH_BATCH_SIZE, len(requests))
+		batch := requests[start:end]
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := sendBatch(source.Client(), batch); err != nil {
+				mu.Lock()
+				batchErr = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if batchErr != nil {
+		return fmt.Errorf("error prefetching state: %w", batchErr)
+	}
+	return nil
+}
+
+func sendBatch(client *ethclient.Client, batch []prefetchRequest) error {
+	elems := make([]rpc.BatchElem, len(batch))
+	for i := range batch {
+		elems[i] = batch[i].elem
+	}
+
+	if err := client.Client().BatchCallContext(context.Background(), elems); err != nil {
+		return err
+	}
+
+	for i := range batch {
+		if elems[i].Error == nil {
+			batch[i].store()
+		}
+	}
+	return nil
+}
+
+func (db *CachingStateDB) accountRequests(addr common.Address, block rpc.BlockNumberOrHash) []prefetchRequest {
+	requests := make([]prefetchRequest, 0, 3)
+
+	if !db.isCached(getBalanceCacheKey(addr), cache.BalanceKey(addr)) {
+		var balance hexutil.Big
+		requests = append(requests, prefetchRequest{
+			elem: rpc.BatchElem{Method: "eth_getBalance", Args: []any{addr, block}, Result: &balance},
+			store: func() {
+				value, _ := uint256.FromBig((*big.Int)(&balance))
+				db.cache.LoadOrStore(getBalanceCacheKey(addr), value)
+				db.persist(cache.BalanceKey(addr), value.Bytes())
+			},
+		})
+	}
+
+	if !db.isCached(getNonceCacheKey(addr), cache.NonceKey(addr)) {
+		var nonce hexutil.Uint64
+		requests = append(requests, prefetchRequest{
+			elem: rpc.BatchElem{Method: "eth_getTransactionCount", Args: []any{addr, block}, Result: &nonce},
+			store: func() {
+				db.cache.LoadOrStore(getNonceCacheKey(addr), uint64(nonce))
+				db.persist(cache.NonceKey(addr), binary.BigEndian.AppendUint64(nil, uint64(nonce)))
+			},
+		})
+	}
+
+	if !db.isCached(getCodeCacheKey(addr), cache.CodeKey(addr)) {
+		var code hexutil.Bytes
+		requests = append(requests, prefetchRequest{
+			elem: rpc.BatchElem{Method: "eth_getCode", Args: []any{addr, block}, Result: &code},
+			store: func() {
+				db.cache.LoadOrStore(getCodeCacheKey(addr), []byte(code))
+				db.persist(cache.CodeKey(addr), code)
+			},
+		})
+	}
+
+	return requests
+}
+
+func (db *CachingStateDB) storageRequest(addr common.Address, key common.Hash, block rpc.BlockNumberOrHash) (prefetchRequest, bool) {
+	if db.storageReplaced[addr] || db.isCached(getStorageCacheKey(addr, key), cache.StorageKey(addr, key)) {
+		return prefetchRequest{}, false
+	}
+
+	var value hexutil.Bytes
+	return prefetchRequest{
+		elem: rpc.BatchElem{Method: "eth_getStorageAt", Args: []any{addr, key, block}, Result: &value},
+		store: func() {
+			db.cache.LoadOrStore(getStorageCacheKey(addr, key), common.BytesToHash(value))
+			db.persist(cache.StorageKey(addr, key), common.BytesToHash(value).Bytes())
+		},
+	}, true
+}
+
+// isCached returns true if the state is already in memory or was persisted by
+// an earlier run, in which case the lazy fetch reads it without the RPC
+func (db *CachingStateDB) isCached(cacheKey common.Hash, persistedKey []byte) bool {
+	if _, ok := db.cache.Load(cacheKey); ok {
+		return true
+	}
+	_, ok := db.loadPersisted(persistedKey)
+	return ok
+}
+
+// recordRead adds an account, and optionally one of its slots, to the read set
+func (db *CachingStateDB) recordRead(addr common.Address, key *common.Hash) {
+	slots, ok := db.reads[addr]
+	if !ok {
+		slots = make(map[common.Hash]struct{})
+		db.reads[addr] = slots
+	}
+	if key != nil {
+		slots[*key] = struct{}{}
+	}
+}
+
+// ReadSet returns every account and slot read during the simulation, sorted so
+// that it can be saved and used to prefetch the next run
+func (db *CachingStateDB) ReadSet() types.AccessList {
+	list := make(types.AccessList, 0, len(db.reads))
+	for addr, slots := range db.reads {
+		keys := make([]common.Hash, 0, len(slots))
+		for key := range slots {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i].Bytes(), keys[j].Bytes()) < 0
+		})
+		list = append(list, types.AccessTuple{Address: addr, StorageKeys: keys})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Address.Bytes(), list[j].Address.Bytes()) < 0
+	})
+	return list
+}
+
+// LoadReadSet reads a read set saved by a previous run. A missing file is not
+// an error, it just means there is nothing to prefetch yet.
+func LoadReadSet(path string) (types.AccessList, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading read set: %w", err)
+	}
+
+	var list types.AccessList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("error parsing read set: %w", err)
+	}
+	return list, nil
+}
+
+// SaveReadSet writes a read set so the next run can prefetch it
+func SaveReadSet(path string, list types.AccessList) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding read set: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing read set: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
+)
+
+// proofVerifier checks every piece of pre-state the simulation reads against
+// eth_getProof Merkle proofs rooted at the pinned header's state root. Only
+// the proofs are trusted, never the values the RPC reports alongside them.
+type proofVerifier struct {
+	client    *rpc.Client
+	block     rpc.BlockNumberOrHash
+	stateRoot common.Hash
+	accounts  map[common.Address]*types.StateAccount
+	checked   map[common.Hash]struct{}
+}
+
+// SetVerifyProofs enables Merkle proof verification of all fetched state. It
+// must be called before any state is read, so that the first read of every
+// account and slot (which is always the pre-state) gets verified. Proofs are
+// fetched with eth_getProof, so this needs an RPC state source.
+func (db *CachingStateDB) SetVerifyProofs(stateRoot common.Hash) error {
+	source, ok := db.source.(*RPCSource)
+	if !ok {
+		return errors.New("proof verification needs an RPC state source")
+	}
+
+	db.proofs = &proofVerifier{
+		client:    source.Client().Client(),
+		block:     source.BlockArg(),
+		stateRoot: stateRoot,
+		accounts:  make(map[common.Address]*types.StateAccount),
+		checked:   make(map[common.Hash]struct{}),
+	}
+	return nil
+}
+
+func (v *proofVerifier) checkBalance(addr common.Address, balance *uint256.Int) error {
+	if v.alreadyChecked(getBalanceCacheKey(addr)) {
+		return nil
+	}
+
+	account, err := v.account(addr)
+	if err != nil {
+		return &ProofError{Kind: "balance", Address: addr, Reason: err.Error()}
+	}
+	if account.Balance.Cmp(balance) != 0 {
+		return &ProofError{Kind: "balance", Address: addr, Reason: fmt.Sprintf("RPC returned %s, proof has %s", balance, account.Balance)}
+	}
+	return nil
+}
+
+func (v *proofVerifier) checkNonce(addr common.Address, nonce uint64) error {
+	if v.alreadyChecked(getNonceCacheKey(addr)) {
+		return nil
+	}
+
+	account, err := v.account(addr)
+	if err != nil {
+		return &ProofError{Kind: "nonce", Address: addr, Reason: err.Error()}
+	}
+	if account.Nonce != nonce {
+		return &ProofError{Kind: "nonce", Address: addr, Reason: fmt.Sprintf("RPC returned %d, proof has %d", nonce, account.Nonce)}
+	}
+	return nil
+}
+
+func (v *proofVerifier) checkCode(addr common.Address, code []byte) error {
+	if v.alreadyChecked(getCodeCacheKey(addr)) {
+		return nil
+	}
+
+	account, err := v.account(addr)
+	if err != nil {
+		return &ProofError{Kind: "code", Address: addr, Reason: err.Error()}
+	}
+	if hash := crypto.Keccak256Hash(code); hash != common.BytesToHash(account.CodeHash) {
+		return &ProofError{Kind: "code", Address: addr, Reason: fmt.Sprintf("RPC code hashes to %s, proof has %s", hash.Hex(), common.BytesToHash(account.CodeHash).Hex())}
+	}
+	return nil
+}
+
+func (v *proofVerifier) checkStorage(addr common.Address, key, value common.Hash) error {
+	if v.alreadyChecked(getStorageCacheKey(addr, key)) {
+		return nil
+	}
+
+	account, err := v.account(addr)
+	if err != nil {
+		return &ProofError{Kind: "storage", Address: addr, Slot: &key, Reason: err.Error()}
+	}
+
+	// Every slot of an account with an empty storage trie is zero
+	if account.Root == types.EmptyRootHash {
+		if value != (common.Hash{}) {
+			return &ProofError{Kind: "storage", Address: addr, Slot: &key, Reason: fmt.Sprintf("RPC returned %s, but the account has no storage", value.Hex())}
+		}
+		return nil
+	}
+
+	result, err := v.getProof(addr, []string{key.Hex()})
+	if err != nil {
+		return &ProofError{Kind: "storage", Address: addr, Slot: &key, Reason: fmt.Sprintf("eth_getProof failed: %v", err)}
+	}
+	if len(result.StorageProof) != 1 {
+		return &ProofError{Kind: "storage", Address: addr, Slot: &key, Reason: fmt.Sprintf("expected 1 storage proof, got %d", len(result.StorageProof))}
+	}
+
+	encoded, err := verifyMerkleProof(account.Root, crypto.Keccak256(key.Bytes()), result.StorageProof[0].Proof)
+	if err != nil {
+		return &ProofError{Kind: "storage", Address: addr, Slot: &key, Reason: err.Error()}
+	}
+
+	// Storage values are RLP encoded with leading zeros trimmed, and a proof
+	// of absence means the slot is zero
+	var proven common.Hash
+	if len(encoded) > 0 {
+		_, content, _, err := rlp.Split(encoded)
+		if err != nil {
+			return &ProofError{Kind: "storage", Address: addr, Slot: &key, Reason: fmt.Sprintf("invalid storage value encoding: %v", err)}
+		}
+		proven = common.BytesToHash(content)
+	}
+
+	if proven != value {
+		return &ProofError{Kind: "storage", Address: addr, Slot: &key, Reason: fmt.Sprintf("RPC returned %s, proof has %s", value.Hex(), proven.Hex())}
+	}
+	return nil
+}
+
+// account returns the account proven against the state root, fetching and
+// verifying its proof the first time the account is seen
+func (v *proofVerifier) account(addr common.Address) (*types.StateAccount, error) {
+	if account, ok := v.accounts[addr]; ok {
+		return account, nil
+	}
+
+	result, err := v.getProof(addr, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("eth_getProof failed: %w", err)
+	}
+
+	encoded, err := verifyMerkleProof(v.stateRoot, crypto.Keccak256(addr.Bytes()), result.AccountProof)
+	if err != nil {
+		return nil, err
+	}
+
+	// A proof of absence means the account does not exist
+	account := types.NewEmptyStateAccount()
+	if len(encoded) > 0 {
+		if err := rlp.DecodeBytes(encoded, account); err != nil {
+			return nil, fmt.Errorf("invalid account encoding: %w", err)
+		}
+	}
+
+	v.accounts[addr] = account
+	return account, nil
+}
+
+// proofResult holds the parts of an eth_getProof response that are verified,
+// the values the RPC reports next to the proofs are never used
+type proofResult struct {
+	AccountProof []string `json:"accountProof"`
+	StorageProof []struct {
+		Proof []string `json:"proof"`
+	} `json:"storageProof"`
+}
+
+// getProof calls eth_getProof for the pinned block. It is called directly
+// rather than through gethclient, which can only select the block by number.
+func (v *proofVerifier) getProof(addr common.Address, keys []string) (*proofResult, error) {
+	var result proofResult
+	if err := v.client.CallContext(context.Background(), &result, "eth_getProof", addr, keys, v.block); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (v *proofVerifier) alreadyChecked(cacheKey common.Hash) bool {
+	if _, ok := v.checked[cacheKey]; ok {
+		return true
+	}
+	v.checked[cacheKey] = struct{}{}
+	return false
+}
+
+// verifyMerkleProof checks a proof given as hex encoded trie nodes and returns
+// the proven value, or nil if the proof shows the key is absent
+func verifyMerkleProof(root common.Hash, key []byte, proof []string) ([]byte, error) {
+	nodes := memorydb.New()
+	for _, node := range proof {
+		encoded := common.FromHex(node)
+		if err := nodes.Put(crypto.Keccak256(encoded), encoded); err != nil {
+			return nil, err
+		}
+	}
+
+	value, err := trie.VerifyProof(root, key, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Merkle proof against root %s: %w", root.Hex(), err)
+	}
+	return value, nil
+}
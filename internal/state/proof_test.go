@@ -0,0 +1,186 @@
+package state
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/ethereum/go-ethereum/trie/trienode"
+	"github.com/ethereum/go-ethereum/triedb"
+	"github.com/holiman/uint256"
+)
+
+var (
+	proofAccount = common.HexToAddress("0x000000000000000000000000000000000000bbbb")
+	proofSlot    = common.HexToHash("0x01")
+	proofValue   = common.HexToHash("0x11")
+)
+
+// tamper modifies a proof before it is returned
+type tamper func(proof []string) []string
+
+// proofNode answers eth_getProof from real tries, optionally tampering with
+// the account or storage proofs it returns
+type proofNode struct {
+	accounts      *trie.Trie
+	storage       *trie.Trie
+	tamperAccount tamper
+	tamperStorage tamper
+}
+
+func (n *proofNode) GetProof(addr common.Address, keys []string, block rpc.BlockNumberOrHash) (*proofResult, error) {
+	result := &proofResult{AccountProof: prove(n.accounts, crypto.Keccak256(addr.Bytes()), n.tamperAccount)}
+	for _, key := range keys {
+		proof := prove(n.storage, crypto.Keccak256(common.HexToHash(key).Bytes()), n.tamperStorage)
+		result.StorageProof = append(result.StorageProof, struct {
+			Proof []string `json:"proof"`
+		}{proof})
+	}
+	return result, nil
+}
+
+func prove(tr *trie.Trie, key []byte, tamper tamper) []string {
+	var nodes trienode.ProofList
+	if err := tr.Prove(key, &nodes); err != nil {
+		panic(err)
+	}
+
+	proof := make([]string, len(nodes))
+	for i, node := range nodes {
+		proof[i] = hexutil.Encode(node)
+	}
+	if tamper != nil {
+		proof = tamper(proof)
+	}
+	return proof
+}
+
+func newTestTrie() *trie.Trie {
+	return trie.NewEmpty(triedb.NewDatabase(rawdb.NewMemoryDatabase(), nil))
+}
+
+// newTestVerifier builds a world with one account holding a few slots and
+// returns a verifier reading its proofs from an in-process node
+func newTestVerifier(t *testing.T, tamperAccount, tamperStorage tamper) *proofVerifier {
+	t.Helper()
+
+	storage := newTestTrie()
+	for i, value := range []common.Hash{proofValue, common.HexToHash("0x22"), common.HexToHash("0x33")} {
+		key := common.BigToHash(big.NewInt(int64(i + 1)))
+		encoded, _ := rlp.EncodeToBytes(common.TrimLeftZeroes(value.Bytes()))
+		storage.MustUpdate(crypto.Keccak256(key.Bytes()), encoded)
+	}
+
+	account := types.NewEmptyStateAccount()
+	account.Nonce = 5
+	account.Balance = uint256.NewInt(100)
+	account.Root = storage.Hash()
+
+	accounts := newTestTrie()
+	for i, addr := range []common.Address{proofAccount, common.HexToAddress("0x01"), common.HexToAddress("0x02")} {
+		other := types.NewEmptyStateAccount()
+		other.Nonce = uint64(i)
+		if addr == proofAccount {
+			other = account
+		}
+		encoded, _ := rlp.EncodeToBytes(other)
+		accounts.MustUpdate(crypto.Keccak256(addr.Bytes()), encoded)
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &proofNode{accounts, storage, tamperAccount, tamperStorage}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	t.Cleanup(func() {
+		client.Close()
+		server.Stop()
+	})
+
+	return &proofVerifier{
+		client:    client,
+		block:     rpc.BlockNumberOrHashWithHash(common.Hash{}, true),
+		stateRoot: accounts.Hash(),
+		accounts:  make(map[common.Address]*types.StateAccount),
+		checked:   make(map[common.Hash]struct{}),
+	}
+}
+
+// tamperLast flips a byte in the last node of a proof, which holds the value
+func tamperLast(proof []string) []string {
+	node := hexutil.MustDecode(proof[len(proof)-1])
+	node[len(node)-1] ^= 0xff
+	proof[len(proof)-1] = hexutil.Encode(node)
+	return proof
+}
+
+func TestProofVerification(t *testing.T) {
+	tests := []struct {
+		name          string
+		tamperAccount tamper
+		tamperStorage tamper
+		check         func(v *proofVerifier) error
+		valid         bool
+	}{
+		{
+			name:  "storage",
+			check: func(v *proofVerifier) error { return v.checkStorage(proofAccount, proofSlot, proofValue) },
+			valid: true,
+		},
+		{
+			name:  "storage value differs from proof",
+			check: func(v *proofVerifier) error { return v.checkStorage(proofAccount, proofSlot, common.HexToHash("0x12")) },
+		},
+		{
+			name:          "tampered storage proof",
+			tamperStorage: tamperLast,
+			check:         func(v *proofVerifier) error { return v.checkStorage(proofAccount, proofSlot, proofValue) },
+		},
+		{
+			name:  "balance",
+			check: func(v *proofVerifier) error { return v.checkBalance(proofAccount, uint256.NewInt(100)) },
+			valid: true,
+		},
+		{
+			name:  "nonce differs from proof",
+			check: func(v *proofVerifier) error { return v.checkNonce(proofAccount, 6) },
+		},
+		{
+			name:          "tampered account proof",
+			tamperAccount: tamperLast,
+			check:         func(v *proofVerifier) error { return v.checkBalance(proofAccount, uint256.NewInt(100)) },
+		},
+		{
+			name: "truncated account proof",
+			tamperAccount: func(proof []string) []string {
+				return proof[:len(proof)-1]
+			},
+			check: func(v *proofVerifier) error { return v.checkNonce(proofAccount, 5) },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.check(newTestVerifier(t, test.tamperAccount, test.tamperStorage))
+			if test.valid {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var proofErr *ProofError
+			if !errors.As(err, &proofErr) {
+				t.Fatalf("got error %v, want a ProofError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package state
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// StateSource provides the state the simulation starts from. CachingStateDB
+// only asks a source for state it hasn't cached yet, and every value is read as
+// of the block the source was created for. A missing account is not an error,
+// it reads as empty just like it would from a node.
+type StateSource interface {
+	Balance(addr common.Address) (*big.Int, error)
+	Nonce(addr common.Address) (uint64, error)
+	Code(addr common.Address) ([]byte, error)
+	Storage(addr common.Address, key common.Hash) (common.Hash, error)
+	Header(number uint64) (*types.Header, error)
+}
+
+// RPCSource reads state from a node over JSON-RPC. State is read by block hash
+// rather than number, so a reorg can't swap the block out from under the
+// simulation.
+type RPCSource struct {
+	client    *ethclient.Client
+	blockHash common.Hash
+}
+
+// NewRPCSource creates a source reading state as of the given block hash
+func NewRPCSource(client *ethclient.Client, blockHash common.Hash) *RPCSource {
+	return &RPCSource{client: client, blockHash: blockHash}
+}
+
+// Client returns the underlying client, for batching and proofs
+func (s *RPCSource) Client() *ethclient.Client {
+	return s.client
+}
+
+// BlockArg returns the block to pass to raw JSON-RPC calls, requiring the
+// pinned block to be canonical
+func (s *RPCSource) BlockArg() rpc.BlockNumberOrHash {
+	return rpc.BlockNumberOrHashWithHash(s.blockHash, true)
+}
+
+func (s *RPCSource) Balance(addr common.Address) (*big.Int, error) {
+	return s.client.BalanceAtHash(context.Background(), addr, s.blockHash)
+}
+
+func (s *RPCSource) Nonce(addr common.Address) (uint64, error) {
+	return s.client.NonceAtHash(context.Background(), addr, s.blockHash)
+}
+
+func (s *RPCSource) Code(addr common.Address) ([]byte, error) {
+	return s.client.CodeAtHash(context.Background(), addr, s.blockHash)
+}
+
+func (s *RPCSource) Storage(addr common.Address, key common.Hash) (common.Hash, error) {
+	value, err := s.client.StorageAtHash(context.Background(), addr, key, s.blockHash)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(value), nil
+}
+
+func (s *RPCSource) Header(number uint64) (*types.Header, error) {
+	return s.client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(number))
+}
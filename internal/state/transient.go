@@ -0,0 +1,42 @@
+package state
+
+import "github.com/ethereum/go-ethereum/common"
+
+// TransientWrite is a single EIP-1153 TSTORE performed during the simulation
+type TransientWrite struct {
+	Address common.Address
+	Key     common.Hash
+	Value   common.Hash
+}
+
+// transientStorage is the per-transaction EIP-1153 storage, cleared on Prepare
+type transientStorage map[common.Address]map[common.Hash]common.Hash
+
+func newTransientStorage() transientStorage {
+	return make(transientStorage)
+}
+
+func (t transientStorage) Get(addr common.Address, key common.Hash) common.Hash {
+	slots, ok := t[addr]
+	if !ok {
+		return common.Hash{}
+	}
+	return slots[key]
+}
+
+func (t transientStorage) Set(addr common.Address, key, value common.Hash) {
+	if value == (common.Hash{}) {
+		if slots, ok := t[addr]; ok {
+			delete(slots, key)
+			if len(slots) == 0 {
+				delete(t, addr)
+			}
+		}
+		return
+	}
+
+	if _, ok := t[addr]; !ok {
+		t[addr] = make(map[common.Hash]common.Hash)
+	}
+	t[addr][key] = value
+}
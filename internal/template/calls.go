@@ -0,0 +1,39 @@
+package template
+
+import (
+	"fmt"
+
+	"github.com/jackchuma/state-diff/internal/calldata"
+)
+
+// BuildCalls converts the decoded calldata tree to JSON format
+func (g *FileGenerator) BuildCalls(call *calldata.Call) *DecodedCall {
+	if call == nil {
+		return nil
+	}
+
+	result := &DecodedCall{
+		Function:     call.Function,
+		Target:       call.Target.Hex(),
+		Name:         g.contractName(call.Target),
+		Operation:    call.Operation.String(),
+		AllowFailure: call.AllowFailure,
+	}
+	if call.Value != nil && call.Value.Sign() != 0 {
+		result.Value = call.Value.String()
+	}
+	if selector := call.Selector(); selector != nil {
+		result.Selector = fmt.Sprintf("0x%x", selector)
+	}
+	if call.ApprovedHash != nil {
+		result.ApprovedHash = call.ApprovedHash.Hex()
+	}
+	if call.Error != nil {
+		result.Error = call.Error.Error()
+	}
+
+	for _, inner := range call.Calls {
+		result.Calls = append(result.Calls, *g.BuildCalls(inner))
+	}
+	return result
+}
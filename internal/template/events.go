@@ -0,0 +1,137 @@
+package template
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackchuma/state-diff/internal/state"
+)
+
+// eventIndex maps an event topic to every event in the config ABIs that shares
+// it. The same signature can appear more than once with different indexed
+// arguments (e.g. Safe v1.3.0 vs v1.4.1), so all candidates are kept.
+type eventIndex map[common.Hash][]abi.Event
+
+func newEventIndex(abis map[string]string) (eventIndex, error) {
+	index := make(eventIndex)
+
+	// Sort ABI names so that decoding is deterministic when candidates overlap
+	names := make([]string, 0, len(abis))
+	for name := range abis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		parsed, err := abi.JSON(strings.NewReader(abis[name]))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing abi '%s': %w", name, err)
+		}
+
+		for _, event := range parsed.Events {
+			index[event.ID] = append(index[event.ID], event)
+		}
+	}
+
+	return index, nil
+}
+
+// decode attempts to decode a log against the known events, returning false
+// when no event matches the log's topics and data
+func (idx eventIndex) decode(log *types.Log) (*abi.Event, []EventArg, bool) {
+	if len(log.Topics) == 0 {
+		return nil, nil, false
+	}
+
+	for _, event := range idx[log.Topics[0]] {
+		args, err := decodeEventArgs(event, log)
+		if err == nil {
+			return &event, args, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+func decodeEventArgs(event abi.Event, log *types.Log) ([]EventArg, error) {
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if len(log.Topics)-1 != len(indexed) {
+		return nil, fmt.Errorf("expected %d indexed topics, got %d", len(indexed), len(log.Topics)-1)
+	}
+
+	values := make(map[string]any)
+	if err := abi.ParseTopicsIntoMap(values, indexed, log.Topics[1:]); err != nil {
+		return nil, err
+	}
+	if err := event.Inputs.NonIndexed().UnpackIntoMap(values, log.Data); err != nil {
+		return nil, err
+	}
+
+	args := make([]EventArg, 0, len(event.Inputs))
+	for _, input := range event.Inputs {
+		args = append(args, EventArg{
+			Name:  input.Name,
+			Type:  input.Type.String(),
+			Value: formatABIValue(values[input.Name]),
+		})
+	}
+
+	return args, nil
+}
+
+// convertLogsToJSON converts the emitted logs to JSON format, decoding them
+// when a matching event is known
+func (g *FileGenerator) convertLogsToJSON(logs []state.Log) []Event {
+	result := make([]Event, 0, len(logs))
+
+	for _, log := range logs {
+		contract := g.getContractCfg(log.Address.Hex())
+		event := Event{
+			Name:    contract.Name,
+			Address: log.Address.Hex(),
+			Depth:   log.Depth,
+		}
+
+		if decoded, args, ok := g.events.decode(&log.Log); ok {
+			event.Event = decoded.Sig
+			event.Args = args
+		} else {
+			event.Topics = make([]string, 0, len(log.Topics))
+			for _, topic := range log.Topics {
+				event.Topics = append(event.Topics, topic.Hex())
+			}
+			event.Data = fmt.Sprintf("0x%x", log.Data)
+		}
+
+		result = append(result, event)
+	}
+
+	return result
+}
+
+func formatABIValue(value any) string {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex()
+	case common.Hash:
+		return v.Hex()
+	case [32]byte:
+		return common.Hash(v).Hex()
+	case []byte:
+		return fmt.Sprintf("0x%x", v)
+	case *big.Int:
+		return v.String()
+	}
+
+	return fmt.Sprint(value)
+}
@@ -5,8 +5,15 @@ type ValidationResult struct {
 	DomainHash     string          `json:"domain_hash"`
 	MessageHash    string          `json:"message_hash"`
 	TargetSafe     string          `json:"target_safe"`
+	Block          BlockInfo       `json:"block"`
 	StateOverrides []StateOverride `json:"state_overrides"`
 	StateChanges   []StateChange   `json:"state_changes"`
+	Deployments    []Deployment    `json:"deployments"`
+	Events         []Event         `json:"events"`
+	Debug          *DebugInfo      `json:"debug,omitempty"`
+	Trace          *TraceCall      `json:"trace,omitempty"`
+	Calls          *DecodedCall    `json:"calls,omitempty"`
+	SafeLevels     []SafeLevel     `json:"safe_levels,omitempty"`
 }
 
 // JSON types that match the expected validation format (base-nested.json)
@@ -15,10 +22,17 @@ type ValidationResultFormatted struct {
 	ScriptName                        string                           `json:"script_name"`
 	Signature                         string                           `json:"signature"`
 	Args                              string                           `json:"args"`
+	Block                             BlockInfo                        `json:"block"`
 	ExpectedDomainAndMessageHashes    DomainAndMessageHashes           `json:"expected_domain_and_message_hashes"`
 	ExpectedNestedHash                string                           `json:"expected_nested_hash"`
 	StateOverrides                    []StateOverride                  `json:"state_overrides"`
 	StateChanges                      []StateChange                    `json:"state_changes"`
+	Deployments                       []Deployment                     `json:"deployments"`
+	Events                            []Event                          `json:"events"`
+	Debug                             *DebugInfo                       `json:"debug,omitempty"`
+	Trace                             *TraceCall                       `json:"trace,omitempty"`
+	Calls                             *DecodedCall                     `json:"calls,omitempty"`
+	SafeLevels                        []SafeLevel                      `json:"safe_levels,omitempty"`
 }
 
 type DomainAndMessageHashes struct {
@@ -27,27 +41,151 @@ type DomainAndMessageHashes struct {
 	MessageHash string `json:"message_hash"`
 }
 
+// SafeLevel is a Safe in a nested approval. The first level is the Safe whose
+// owners sign, each following level is the Safe whose TxHash the level before
+// approves. A Safe whose transaction wasn't simulated is unverified, only the
+// ApprovedHash of the level before is known and its hashes are left empty.
+type SafeLevel struct {
+	Name         string `json:"name"`
+	Address      string `json:"address"`
+	Nonce        string `json:"nonce"`
+	DomainHash   string `json:"domain_hash"`
+	MessageHash  string `json:"message_hash,omitempty"`
+	TxHash       string `json:"tx_hash,omitempty"`
+	ApprovedHash string `json:"approved_hash,omitempty"`
+	Verified     bool   `json:"verified"`
+}
+
+// BlockInfo identifies the block the simulation was run against
+type BlockInfo struct {
+	Number    string                 `json:"number"`
+	Hash      string                 `json:"hash"`
+	Overrides *BlockContextOverrides `json:"overrides,omitempty"`
+}
+
+// BlockContextOverrides lists the block context values the simulation assumed
+// in place of the pinned block's
+type BlockContextOverrides struct {
+	Number     string `json:"number,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+	BaseFee    string `json:"base_fee,omitempty"`
+	GasLimit   string `json:"gas_limit,omitempty"`
+	Coinbase   string `json:"coinbase,omitempty"`
+	PrevRandao string `json:"prev_randao,omitempty"`
+}
+
 type StateOverride struct {
-	Name      string     `json:"name"`
-	Address   string     `json:"address"`
-	Overrides []Override `json:"overrides"`
+	Name           string     `json:"name"`
+	Address        string     `json:"address"`
+	Balance        string     `json:"balance,omitempty"`
+	Nonce          *uint64    `json:"nonce,omitempty"`
+	CodeHash       string     `json:"code_hash,omitempty"`
+	ReplaceStorage bool       `json:"replace_storage,omitempty"`
+	Overrides      []Override `json:"overrides"`
 }
 
 type StateChange struct {
-	Name    string   `json:"name"`
-	Address string   `json:"address"`
-	Changes []Change `json:"changes"`
+	Name     string   `json:"name"`
+	Address  string   `json:"address"`
+	CodeHash string   `json:"code_hash,omitempty"`
+	Changes  []Change `json:"changes"`
 }
 
 type Override struct {
-	Key         string `json:"key"`
-	Value       string `json:"value"`
-	Description string `json:"description"`
+	Key          string `json:"key"`
+	Value        string `json:"value"`
+	DecodedValue string `json:"decoded_value,omitempty"`
+	Description  string `json:"description"`
 }
 
 type Change struct {
-	Key         string `json:"key"`
-	Before      string `json:"before"`
-	After       string `json:"after"`
-	Description string `json:"description"`
+	Key           string `json:"key"`
+	Before        string `json:"before"`
+	After         string `json:"after"`
+	DecodedBefore string `json:"decoded_before,omitempty"`
+	DecodedAfter  string        `json:"decoded_after,omitempty"`
+	Description   string        `json:"description"`
+	Fields        []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a field of a packed slot, decoded before and after the change
+type FieldChange struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Offset  int    `json:"offset"`
+	Size    int    `json:"size"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Changed bool   `json:"changed"`
+}
+
+// Deployment is a contract created during the simulation
+type Deployment struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Deployer string `json:"deployer"`
+	CodeHash string `json:"code_hash"`
+}
+
+// Event is a log emitted during the simulation. Event and Args are set when the
+// log matches an ABI from the config, otherwise the raw Topics and Data are set.
+type Event struct {
+	Name    string     `json:"name"`
+	Address string     `json:"address"`
+	Depth   int        `json:"depth"`
+	Event   string     `json:"event,omitempty"`
+	Args    []EventArg `json:"args,omitempty"`
+	Topics  []string   `json:"topics,omitempty"`
+	Data    string     `json:"data,omitempty"`
+}
+
+type EventArg struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// TraceCall is a call frame of the simulated transaction. Name is the name of
+// the called contract in the config, if it is known.
+type TraceCall struct {
+	Type    string      `json:"type"`
+	From    string      `json:"from"`
+	To      string      `json:"to"`
+	Name    string      `json:"name,omitempty"`
+	Value   string      `json:"value,omitempty"`
+	Input   string      `json:"input"`
+	Output  string      `json:"output,omitempty"`
+	Gas     uint64      `json:"gas"`
+	GasUsed uint64      `json:"gas_used"`
+	Error   string      `json:"error,omitempty"`
+	Calls   []TraceCall `json:"calls,omitempty"`
+}
+
+// DecodedCall is a call decoded from the transaction's calldata, with the Safe
+// transactions, MultiSend batches and Multicall3 batches it contains decoded
+// into Calls. Function is empty when the calldata isn't a known function.
+type DecodedCall struct {
+	Function     string        `json:"function,omitempty"`
+	Target       string        `json:"target"`
+	Name         string        `json:"name,omitempty"`
+	Operation    string        `json:"operation"`
+	Value        string        `json:"value,omitempty"`
+	Selector     string        `json:"selector,omitempty"`
+	AllowFailure bool          `json:"allow_failure,omitempty"`
+	ApprovedHash string        `json:"approved_hash,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	Calls        []DecodedCall `json:"calls,omitempty"`
+}
+
+// DebugInfo holds simulation details that are useful when investigating a task
+// but are not part of the state that signers validate
+type DebugInfo struct {
+	TransientStorage []TransientStorageWrite `json:"transient_storage"`
+}
+
+type TransientStorageWrite struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
 }
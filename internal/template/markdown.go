@@ -0,0 +1,170 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackchuma/state-diff/internal/state"
+)
+
+// BuildValidationMarkdown renders the validation data as a Markdown report for
+// signers, in the style of the VALIDATION.md files of task repos
+func (g *FileGenerator) BuildValidationMarkdown(safe string, overrides []state.Override, diffs []state.StateDiff, domainHash, messageHash []byte) (string, error) {
+	result, err := g.BuildValidationJSON("", "", "", "", safe, overrides, diffs, domainHash, messageHash)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Validation\n\n")
+	sb.WriteString("This document can be used to validate the inputs and result of the execution of the transaction which you are signing.\n\n")
+	sb.WriteString("The steps are:\n\n")
+	sb.WriteString("1. [Validate the Domain and Message Hashes](#expected-domain-and-message-hashes)\n")
+	sb.WriteString("2. [Verify the state overrides](#state-overrides)\n")
+	sb.WriteString("3. [Verify the state changes](#task-state-changes)\n\n")
+	fmt.Fprintf(&sb, "Simulated against block %s (`%s`).\n\n", result.Block.Number, result.Block.Hash)
+
+	g.writeMarkdownHashes(&sb, result)
+	g.writeMarkdownOverrides(&sb, result.StateOverrides)
+	g.writeMarkdownChanges(&sb, result.StateChanges)
+	g.writeMarkdownDeployments(&sb, result.Deployments)
+	return sb.String(), nil
+}
+
+func (g *FileGenerator) writeMarkdownHashes(sb *strings.Builder, result *ValidationResultFormatted) {
+	sb.WriteString("## Expected Domain and Message Hashes\n\n")
+	sb.WriteString("First, we need to validate the domain and message hashes. These values should match both the values on your ledger and the values printed to the terminal when you run the task.\n\n")
+	sb.WriteString("> [!CAUTION]\n>\n")
+	sb.WriteString("> Before signing, ensure the data being signed matches the hashes below.\n>\n")
+
+	hashes := result.ExpectedDomainAndMessageHashes
+	fmt.Fprintf(sb, "> ### %s (`%s`)\n>\n", g.getContractCfg(hashes.Address).Name, hashes.Address)
+	fmt.Fprintf(sb, "> - Domain Hash: `%s`\n", hashes.DomainHash)
+	fmt.Fprintf(sb, "> - Message Hash: `%s`\n", hashes.MessageHash)
+	if result.ExpectedNestedHash != "" {
+		fmt.Fprintf(sb, "> - Nested Hash: `%s`\n", result.ExpectedNestedHash)
+	}
+	sb.WriteString("\n")
+
+	for _, level := range result.SafeLevels {
+		if !level.Verified {
+			sb.WriteString("> [!WARNING]\n>\n")
+			fmt.Fprintf(sb, "> The transaction of %s (`%s`) is not part of the simulation, so the hash `%s` approved on it could not be verified.\n\n", level.Name, level.Address, level.ApprovedHash)
+		}
+	}
+
+	if len(result.SafeLevels) == 0 {
+		return
+	}
+	sb.WriteString("The signing Safe approves the transaction of the Safe above it, up to the Safe that executes the task:\n\n")
+	sb.WriteString("| Safe | Address | Nonce | Domain Hash | Message Hash | Transaction Hash |\n")
+	sb.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+	for _, level := range result.SafeLevels {
+		txHash := markdownCode(level.TxHash)
+		if !level.Verified {
+			txHash = fmt.Sprintf("unverified, approved `%s`", level.ApprovedHash)
+		}
+		fmt.Fprintf(sb, "| %s | `%s` | %s | `%s` | %s | %s |\n", level.Name, level.Address, level.Nonce, level.DomainHash, markdownCode(level.MessageHash), txHash)
+	}
+	sb.WriteString("\n")
+}
+
+func (g *FileGenerator) writeMarkdownOverrides(sb *strings.Builder, overrides []StateOverride) {
+	sb.WriteString("## State Overrides\n\n")
+	if len(overrides) == 0 {
+		sb.WriteString("No state overrides were applied.\n\n")
+		return
+	}
+	sb.WriteString("The following state overrides are applied for the simulation only, they are not part of the transaction being signed.\n\n")
+
+	for _, override := range overrides {
+		fmt.Fprintf(sb, "### %s - `%s`\n\n", override.Name, override.Address)
+		if override.Balance != "" {
+			fmt.Fprintf(sb, "- **Balance**: %s\n", override.Balance)
+		}
+		if override.Nonce != nil {
+			fmt.Fprintf(sb, "- **Nonce**: %d\n", *override.Nonce)
+		}
+		if override.CodeHash != "" {
+			fmt.Fprintf(sb, "- **Code Hash**: `%s`\n", override.CodeHash)
+		}
+		if override.ReplaceStorage {
+			sb.WriteString("- **Storage**: replaced, every slot not listed below reads as zero\n")
+		}
+		for _, storageOverride := range override.Overrides {
+			fmt.Fprintf(sb, "- **Key**: `%s` <br/>\n", storageOverride.Key)
+			fmt.Fprintf(sb, "  **Override**: `%s` <br/>\n", storageOverride.Value)
+			fmt.Fprintf(sb, "  **Decoded Value**: `%s` <br/>\n", storageOverride.DecodedValue)
+			fmt.Fprintf(sb, "  **Meaning**: %s\n", storageOverride.Description)
+		}
+		sb.WriteString("\n")
+	}
+}
+
+func (g *FileGenerator) writeMarkdownChanges(sb *strings.Builder, changes []StateChange) {
+	sb.WriteString("## Task State Changes\n\n")
+	if len(changes) == 0 {
+		sb.WriteString("The transaction makes no state changes.\n\n")
+		return
+	}
+
+	for _, stateChange := range changes {
+		contract := g.getContractCfg(stateChange.Address)
+		fmt.Fprintf(sb, "### %s - `%s`\n\n", stateChange.Name, stateChange.Address)
+		if stateChange.CodeHash != "" {
+			fmt.Fprintf(sb, "- **New Code Hash**: `%s`\n\n", stateChange.CodeHash)
+		}
+
+		for i, change := range stateChange.Changes {
+			slot := g.getSlot(&contract, change.Key)
+			fmt.Fprintf(sb, "%d. **Key**: `%s` <br/>\n", i, change.Key)
+			fmt.Fprintf(sb, "   **Before**: `%s` <br/>\n", change.Before)
+			fmt.Fprintf(sb, "   **After**: `%s` <br/>\n", change.After)
+			fmt.Fprintf(sb, "   **Value Type**: %s <br/>\n", slot.Type)
+			fmt.Fprintf(sb, "   **Decoded Old Value**: `%s` <br/>\n", change.DecodedBefore)
+			fmt.Fprintf(sb, "   **Decoded New Value**: `%s` <br/>\n", change.DecodedAfter)
+			fmt.Fprintf(sb, "   **Meaning**: %s\n\n", change.Description)
+			writeMarkdownFields(sb, change.Fields)
+		}
+	}
+}
+
+// writeMarkdownFields lists the fields of a packed slot, marking those changed
+func writeMarkdownFields(sb *strings.Builder, fields []FieldChange) {
+	if len(fields) == 0 {
+		return
+	}
+
+	sb.WriteString("   | Field | Type | Offset | Size | Before | After | Changed |\n")
+	sb.WriteString("   | --- | --- | --- | --- | --- | --- | --- |\n")
+	for _, field := range fields {
+		changed := ""
+		if field.Changed {
+			changed = "**Yes**"
+		}
+		fmt.Fprintf(sb, "   | %s | %s | %d | %d | `%s` | `%s` | %s |\n", field.Name, field.Type, field.Offset, field.Size, field.Before, field.After, changed)
+	}
+	sb.WriteString("\n")
+}
+
+func (g *FileGenerator) writeMarkdownDeployments(sb *strings.Builder, deployments []Deployment) {
+	if len(deployments) == 0 {
+		return
+	}
+
+	sb.WriteString("## Deployments\n\n")
+	sb.WriteString("| Name | Address | Deployer | Code Hash |\n")
+	sb.WriteString("| --- | --- | --- | --- |\n")
+	for _, deployment := range deployments {
+		fmt.Fprintf(sb, "| %s | `%s` | `%s` | `%s` |\n", deployment.Name, deployment.Address, deployment.Deployer, deployment.CodeHash)
+	}
+	sb.WriteString("\n")
+}
+
+// markdownCode wraps a value in backticks, leaving empty values empty
+func markdownCode(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "`" + value + "`"
+}
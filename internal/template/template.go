@@ -4,19 +4,34 @@ import (
 	_ "embed"
 	"fmt"
 	"math/big"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/jackchuma/state-diff/config"
+	"github.com/jackchuma/state-diff/internal/evm"
+	"github.com/jackchuma/state-diff/internal/safe"
 	"github.com/jackchuma/state-diff/internal/state"
 	"gopkg.in/yaml.v2"
 )
 
 type Slot struct {
-	Type            string `yaml:"type"`
-	Summary         string `yaml:"summary"`
-	OverrideMeaning string `yaml:"override-meaning"`
+	Type            string      `yaml:"type"`
+	Summary         string      `yaml:"summary"`
+	OverrideMeaning string      `yaml:"override-meaning"`
+	Fields          []SlotField `yaml:"fields"`
+}
+
+// SlotField is a value packed into a "hybrid" slot. Offset is in bytes from the
+// least significant end of the slot, following Solidity's storage layout.
+type SlotField struct {
+	Name   string `yaml:"name"`
+	Type   string `yaml:"type"`
+	Offset int    `yaml:"offset"`
+	Size   int    `yaml:"size"`
 }
 
 type Contract struct {
@@ -27,17 +42,24 @@ type Contract struct {
 type Config struct {
 	Contracts      map[string]map[string]Contract `yaml:"contracts"`
 	StorageLayouts map[string]map[string]Slot     `yaml:"storage-layouts"`
+	ABIs           map[string]string              `yaml:"abis"`
 }
 
 var DEFAULT_CONTRACT = Contract{Name: "<<ContractName>>", Slots: map[string]Slot{}}
 var DEFAULT_SLOT = Slot{Type: "<<DecodedKind>>", Summary: "<<Summary>>", OverrideMeaning: "<<OverrideMeaning>>"}
 
+// Matches intN and uintN types, with N defaulting to 256
+var INT_TYPE_PATTERN = regexp.MustCompile(`^(u?)int(\d*)$`)
+
 
 
 type FileGenerator struct {
-	db      *state.CachingStateDB
-	chainId string
-	cfg     *Config
+	db             *state.CachingStateDB
+	chainId        string
+	cfg            *Config
+	events         eventIndex
+	blockOverrides *evm.BlockOverrides
+	safeLevels     []*safe.Hashes
 }
 
 func NewFileGenerator(db *state.CachingStateDB, chainId string) (*FileGenerator, error) {
@@ -46,7 +68,13 @@ func NewFileGenerator(db *state.CachingStateDB, chainId string) (*FileGenerator,
 		fmt.Printf("Error loading config: %v\n", err)
 		return nil, err
 	}
-	return &FileGenerator{db, chainId, cfg}, nil
+
+	events, err := newEventIndex(cfg.ABIs)
+	if err != nil {
+		fmt.Printf("Error loading event ABIs: %v\n", err)
+		return nil, err
+	}
+	return &FileGenerator{db, chainId, cfg, events, nil, nil}, nil
 }
 
 func loadConfig() (*Config, error) {
@@ -75,6 +103,7 @@ func (c *Config) UnmarshalYAML() error {
 	type auxConfigStructure struct {
 		Contracts      map[string]map[string]auxContractDefinition `yaml:"contracts"`
 		StorageLayouts map[string]map[string]Slot                  `yaml:"storage-layouts"`
+		ABIs           map[string]string                           `yaml:"abis"`
 	}
 
 	var rawAuxData auxConfigStructure
@@ -82,7 +111,18 @@ func (c *Config) UnmarshalYAML() error {
 		return fmt.Errorf("error unmarshaling raw config structure: %w", err)
 	}
 
+	for layoutName, layout := range rawAuxData.StorageLayouts {
+		for slotKey, slot := range layout {
+			for _, field := range slot.Fields {
+				if field.Size <= 0 || field.Offset < 0 || field.Offset+field.Size > 32 {
+					return fmt.Errorf("field '%s' of slot %s in storage layout '%s' doesn't fit in a slot: offset %d, size %d", field.Name, slotKey, layoutName, field.Offset, field.Size)
+				}
+			}
+		}
+	}
+
 	c.StorageLayouts = rawAuxData.StorageLayouts
+	c.ABIs = rawAuxData.ABIs
 	c.Contracts = make(map[string]map[string]Contract)
 
 	for chainID, contractAddressesMap := range rawAuxData.Contracts {
@@ -126,8 +166,12 @@ func (g *FileGenerator) BuildValidationJSONForTool(safe string, overrides []stat
 		DomainHash:     fmt.Sprintf("0x%x", domainHash),
 		MessageHash:    fmt.Sprintf("0x%x", messageHash),
 		TargetSafe:     safe,
+		Block:          g.blockInfo(),
 		StateOverrides: g.convertOverridesToJSON(overrides),
 		StateChanges:   g.convertDiffsToJSON(diffs),
+		Deployments:    g.convertDeploymentsToJSON(diffs),
+		Events:         g.convertLogsToJSON(g.db.GetLogs()),
+		SafeLevels:     g.convertSafeLevelsToJSON(),
 	}
 	return result, nil
 }
@@ -139,18 +183,106 @@ func (g *FileGenerator) BuildValidationJSON(taskName, scriptName, signature, arg
 		ScriptName: scriptName,
 		Signature:  signature,
 		Args:       args,
+		Block:      g.blockInfo(),
 		ExpectedDomainAndMessageHashes: DomainAndMessageHashes{
 			Address:     safe,
 			DomainHash:  fmt.Sprintf("0x%x", domainHash),
 			MessageHash: fmt.Sprintf("0x%x", messageHash),
 		},
-		ExpectedNestedHash: "", // This can be set later if needed
+		ExpectedNestedHash: g.expectedNestedHash(),
 		StateOverrides:     g.convertOverridesToJSON(overrides),
 		StateChanges:       g.convertDiffsToJSON(diffs),
+		Deployments:        g.convertDeploymentsToJSON(diffs),
+		Events:             g.convertLogsToJSON(g.db.GetLogs()),
+		SafeLevels:         g.convertSafeLevelsToJSON(),
 	}
 	return result, nil
 }
 
+// SetSafeLevels includes the Safes of a nested approval in the output, starting
+// with the Safe whose owners sign
+func (g *FileGenerator) SetSafeLevels(levels []*safe.Hashes) {
+	g.safeLevels = levels
+}
+
+// expectedNestedHash returns the hash of the parent Safe's transaction that the
+// signing Safe approves, or an empty string if the approval isn't nested or the
+// hash could not be computed from the parent's transaction
+func (g *FileGenerator) expectedNestedHash() string {
+	if len(g.safeLevels) < 2 || g.safeLevels[1].Unverified {
+		return ""
+	}
+	return g.safeLevels[1].TxHash.Hex()
+}
+
+// convertSafeLevelsToJSON converts the Safes of a nested approval to JSON format
+func (g *FileGenerator) convertSafeLevelsToJSON() []SafeLevel {
+	if len(g.safeLevels) < 2 {
+		return nil
+	}
+
+	result := make([]SafeLevel, 0, len(g.safeLevels))
+	for _, level := range g.safeLevels {
+		safeLevel := SafeLevel{
+			Name:       g.getContractCfg(level.Safe.Hex()).Name,
+			Address:    level.Safe.Hex(),
+			Nonce:      level.Nonce.String(),
+			DomainHash: level.DomainHash.Hex(),
+			TxHash:     level.TxHash.Hex(),
+			Verified:   !level.Unverified,
+		}
+		if level.MessageHash != (common.Hash{}) {
+			safeLevel.MessageHash = level.MessageHash.Hex()
+		}
+		if level.Unverified {
+			safeLevel.TxHash = ""
+			safeLevel.ApprovedHash = level.TxHash.Hex()
+		}
+		result = append(result, safeLevel)
+	}
+	return result
+}
+
+// SetBlockOverrides includes the block context overrides the simulation ran
+// with in the output
+func (g *FileGenerator) SetBlockOverrides(overrides *evm.BlockOverrides) {
+	g.blockOverrides = overrides
+}
+
+// blockInfo returns the block the simulated state was read from, along with
+// any overridden block context values
+func (g *FileGenerator) blockInfo() BlockInfo {
+	info := BlockInfo{
+		Number: g.db.BlockNumber().String(),
+		Hash:   g.db.BlockHash().Hex(),
+	}
+	if g.blockOverrides.IsEmpty() {
+		return info
+	}
+
+	o := g.blockOverrides
+	info.Overrides = &BlockContextOverrides{}
+	if o.Number != nil {
+		info.Overrides.Number = o.Number.String()
+	}
+	if o.Time != nil {
+		info.Overrides.Timestamp = fmt.Sprintf("%d", *o.Time)
+	}
+	if o.BaseFee != nil {
+		info.Overrides.BaseFee = o.BaseFee.String()
+	}
+	if o.GasLimit != nil {
+		info.Overrides.GasLimit = fmt.Sprintf("%d", *o.GasLimit)
+	}
+	if o.Coinbase != nil {
+		info.Overrides.Coinbase = o.Coinbase.Hex()
+	}
+	if o.PrevRandao != nil {
+		info.Overrides.PrevRandao = o.PrevRandao.Hex()
+	}
+	return info
+}
+
 // convertOverridesToJSON converts state overrides to JSON format
 func (g *FileGenerator) convertOverridesToJSON(overrides []state.Override) []StateOverride {
 	result := make([]StateOverride, 0, len(overrides))
@@ -162,27 +294,37 @@ func (g *FileGenerator) convertOverridesToJSON(overrides []state.Override) []Sta
 
 	for _, override := range overrides {
 		contract := g.getContractCfg(override.ContractAddress.Hex())
-		jsonOverrides := make([]Override, 0, len(override.Storage))
+		storageOverrides := override.StorageOverrides()
+		jsonOverrides := make([]Override, 0, len(storageOverrides))
 
-		// Sort storage overrides by key
-		sort.Slice(override.Storage, func(i, j int) bool {
-			return override.Storage[i].Key.String() < override.Storage[j].Key.String()
-		})
-
-		for _, storageOverride := range override.Storage {
+		for _, storageOverride := range storageOverrides {
 			slot := g.getSlot(&contract, storageOverride.Key.Hex())
 			jsonOverrides = append(jsonOverrides, Override{
-				Key:         storageOverride.Key.Hex(),
-				Value:       storageOverride.Value.Hex(),
-				Description: slot.OverrideMeaning,
+				Key:          storageOverride.Key.Hex(),
+				Value:        storageOverride.Value.Hex(),
+				DecodedValue: g.decodeSlotValue(slot, storageOverride.Value),
+				Description:  slot.OverrideMeaning,
 			})
 		}
 
-		result = append(result, StateOverride{
-			Name:      contract.Name,
-			Address:   override.ContractAddress.Hex(),
-			Overrides: jsonOverrides,
-		})
+		stateOverride := StateOverride{
+			Name:           contract.Name,
+			Address:        override.ContractAddress.Hex(),
+			ReplaceStorage: override.ReplacesStorage(),
+			Overrides:      jsonOverrides,
+		}
+		if override.Balance != nil {
+			stateOverride.Balance = override.Balance.ToInt().String()
+		}
+		if override.Nonce != nil {
+			nonce := uint64(*override.Nonce)
+			stateOverride.Nonce = &nonce
+		}
+		if override.Code != nil {
+			stateOverride.CodeHash = crypto.Keccak256Hash(*override.Code).Hex()
+		}
+
+		result = append(result, stateOverride)
 	}
 
 	return result
@@ -220,19 +362,28 @@ func (g *FileGenerator) convertDiffsToJSON(diffs []state.StateDiff) []StateChang
 
 			slot := g.getSlot(&contract, storageDiff.Key.String())
 			jsonChanges = append(jsonChanges, Change{
-				Key:         storageDiff.Key.Hex(),
-				Before:      storageDiff.ValueBefore.Hex(),
-				After:       storageDiff.ValueAfter.Hex(),
-				Description: slot.Summary,
+				Key:           storageDiff.Key.Hex(),
+				Before:        storageDiff.ValueBefore.Hex(),
+				After:         storageDiff.ValueAfter.Hex(),
+				DecodedBefore: g.decodeSlotValue(slot, storageDiff.ValueBefore),
+				DecodedAfter:  g.decodeSlotValue(slot, storageDiff.ValueAfter),
+				Description:   slot.Summary,
+				Fields:        g.convertFieldChanges(slot, storageDiff.ValueBefore, storageDiff.ValueAfter),
 			})
 		}
 
+		codeHash := ""
+		if diff.CodeSeen && diff.CodeHashBefore != diff.CodeHashAfter {
+			codeHash = diff.CodeHashAfter.Hex()
+		}
+
 		// Only add if there are actual changes
-		if len(jsonChanges) > 0 {
+		if len(jsonChanges) > 0 || codeHash != "" {
 			result = append(result, StateChange{
-				Name:    contract.Name,
-				Address: diff.Address.Hex(),
-				Changes: jsonChanges,
+				Name:     contract.Name,
+				Address:  diff.Address.Hex(),
+				CodeHash: codeHash,
+				Changes:  jsonChanges,
 			})
 		}
 	}
@@ -241,6 +392,49 @@ func (g *FileGenerator) convertDiffsToJSON(diffs []state.StateDiff) []StateChang
 }
 
 
+// convertDeploymentsToJSON lists the contracts created during the simulation
+func (g *FileGenerator) convertDeploymentsToJSON(diffs []state.StateDiff) []Deployment {
+	result := make([]Deployment, 0)
+
+	// Sort diffs by address
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Address.String() < diffs[j].Address.String()
+	})
+
+	for _, diff := range diffs {
+		if !diff.Created {
+			continue
+		}
+
+		contract := g.getContractCfg(diff.Address.Hex())
+		result = append(result, Deployment{
+			Name:     contract.Name,
+			Address:  diff.Address.Hex(),
+			Deployer: diff.Deployer.Hex(),
+			CodeHash: diff.CodeHashAfter.Hex(),
+		})
+	}
+
+	return result
+}
+
+// BuildDebugInfo collects the debug-only details of the simulation
+func (g *FileGenerator) BuildDebugInfo() *DebugInfo {
+	writes := g.db.GetTransientWrites()
+	transientStorage := make([]TransientStorageWrite, 0, len(writes))
+
+	for _, write := range writes {
+		contract := g.getContractCfg(write.Address.Hex())
+		transientStorage = append(transientStorage, TransientStorageWrite{
+			Name:    contract.Name,
+			Address: write.Address.Hex(),
+			Key:     write.Key.Hex(),
+			Value:   write.Value.Hex(),
+		})
+	}
+
+	return &DebugInfo{TransientStorage: transientStorage}
+}
 
 func (g *FileGenerator) getContractCfg(address string) Contract {
 	contract, ok := g.cfg.Contracts[g.chainId][strings.ToLower(address)]
@@ -273,15 +467,87 @@ func (g *FileGenerator) getSlot(cfg *Contract, slot string) Slot {
 	}
 }
 
-func getDecodedValue(slotType string, value string) string {
+// decodeSlotValue renders a slot value as the slot's type, or as each of its
+// fields for a packed slot
+func (g *FileGenerator) decodeSlotValue(slot Slot, value common.Hash) string {
+	if len(slot.Fields) == 0 {
+		return g.getDecodedValue(slot.Type, value.Hex())
+	}
+
+	fields := make([]string, len(slot.Fields))
+	for i, field := range slot.Fields {
+		fields[i] = fmt.Sprintf("%s: %s", field.Name, g.getDecodedValue(field.Type, fieldValue(field, value).Hex()))
+	}
+	return strings.Join(fields, ", ")
+}
+
+// convertFieldChanges breaks down a change to a packed slot per field
+func (g *FileGenerator) convertFieldChanges(slot Slot, before, after common.Hash) []FieldChange {
+	if len(slot.Fields) == 0 {
+		return nil
+	}
+
+	result := make([]FieldChange, 0, len(slot.Fields))
+	for _, field := range slot.Fields {
+		fieldBefore := fieldValue(field, before)
+		fieldAfter := fieldValue(field, after)
+		result = append(result, FieldChange{
+			Name:    field.Name,
+			Type:    field.Type,
+			Offset:  field.Offset,
+			Size:    field.Size,
+			Before:  g.getDecodedValue(field.Type, fieldBefore.Hex()),
+			After:   g.getDecodedValue(field.Type, fieldAfter.Hex()),
+			Changed: fieldBefore != fieldAfter,
+		})
+	}
+	return result
+}
+
+// fieldValue extracts a packed field from a slot value, right aligned
+func fieldValue(field SlotField, value common.Hash) common.Hash {
+	end := common.HashLength - field.Offset
+	return common.BytesToHash(value[end-field.Size : end])
+}
+
+// getDecodedValue renders a 32-byte slot value as the slot's type. Addresses of
+// contracts in the config are labelled with their name.
+func (g *FileGenerator) getDecodedValue(slotType string, value string) string {
+	word := common.HexToHash(value)
+
 	switch slotType {
-	case "uint256":
-		// Convert from bytes to uint256
-		bigInt := new(big.Int)
-		bigInt.SetBytes(common.FromHex(value))
-		return bigInt.String()
 	case "address":
-		return common.HexToAddress(value).Hex()
+		addr := common.BytesToAddress(word.Bytes())
+		if name := g.contractName(addr); name != "" {
+			return fmt.Sprintf("%s (%s)", addr.Hex(), name)
+		}
+		return addr.Hex()
+	case "bool":
+		if word == (common.Hash{}) {
+			return "false"
+		}
+		return "true"
+	case "bytes32":
+		return word.Hex()
+	}
+
+	if match := INT_TYPE_PATTERN.FindStringSubmatch(slotType); match != nil {
+		bits := 256
+		if match[2] != "" {
+			bits, _ = strconv.Atoi(match[2])
+			if bits == 0 || bits > 256 || bits%8 != 0 {
+				return "<<DecodedValue>>"
+			}
+		}
+
+		// Only the lowest bits of the slot hold the value
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits)), big.NewInt(1))
+		bigInt := new(big.Int).And(word.Big(), mask)
+		if match[1] == "" && bigInt.Bit(bits-1) == 1 {
+			// Two's complement for signed integers
+			bigInt.Sub(bigInt, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+		}
+		return bigInt.String()
 	}
 
 	return "<<DecodedValue>>"
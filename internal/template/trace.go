@@ -0,0 +1,98 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackchuma/state-diff/internal/trace"
+)
+
+// Inputs and outputs longer than this are shortened in the text view
+var TRACE_TEXT_MAX_BYTES = 36
+
+// BuildTrace converts the call tree to JSON format
+func (g *FileGenerator) BuildTrace(call *trace.Call) *TraceCall {
+	if call == nil {
+		return nil
+	}
+
+	result := &TraceCall{
+		Type:    call.Type.String(),
+		From:    call.From.Hex(),
+		To:      call.To.Hex(),
+		Name:    g.contractName(call.To),
+		Input:   fmt.Sprintf("0x%x", call.Input),
+		Gas:     call.Gas,
+		GasUsed: call.GasUsed,
+	}
+	if call.Value != nil && call.Value.Sign() != 0 {
+		result.Value = call.Value.String()
+	}
+	if len(call.Output) > 0 {
+		result.Output = fmt.Sprintf("0x%x", call.Output)
+	}
+	if call.Error != nil {
+		result.Error = call.Error.Error()
+	}
+
+	for _, inner := range call.Calls {
+		result.Calls = append(result.Calls, *g.BuildTrace(inner))
+	}
+	return result
+}
+
+// FormatTrace renders the call tree as indented text, one call per line
+func (g *FileGenerator) FormatTrace(call *trace.Call) string {
+	var sb strings.Builder
+	g.formatTraceCall(&sb, call, 0)
+	return sb.String()
+}
+
+func (g *FileGenerator) formatTraceCall(sb *strings.Builder, call *trace.Call, depth int) {
+	if call == nil {
+		return
+	}
+
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(sb, "%s%s %s -> %s", indent, call.Type, g.formatTraceAddress(call.From), g.formatTraceAddress(call.To))
+	if call.Value != nil && call.Value.Sign() != 0 {
+		fmt.Fprintf(sb, " value=%s", call.Value)
+	}
+	fmt.Fprintf(sb, " gas=%d/%d input=%s", call.GasUsed, call.Gas, shortenBytes(call.Input))
+	if len(call.Output) > 0 {
+		fmt.Fprintf(sb, " output=%s", shortenBytes(call.Output))
+	}
+	if call.Error != nil {
+		fmt.Fprintf(sb, " error=%q", call.Error.Error())
+	}
+	sb.WriteString("\n")
+
+	for _, inner := range call.Calls {
+		g.formatTraceCall(sb, inner, depth+1)
+	}
+}
+
+func (g *FileGenerator) formatTraceAddress(addr common.Address) string {
+	if name := g.contractName(addr); name != "" {
+		return fmt.Sprintf("%s(%s)", name, addr.Hex())
+	}
+	return addr.Hex()
+}
+
+// contractName returns the name of the contract in the config, or an empty
+// string if it isn't known
+func (g *FileGenerator) contractName(addr common.Address) string {
+	contract := g.getContractCfg(addr.Hex())
+	if contract.Name == DEFAULT_CONTRACT.Name {
+		return ""
+	}
+	return contract.Name
+}
+
+func shortenBytes(data []byte) string {
+	if len(data) <= TRACE_TEXT_MAX_BYTES {
+		return fmt.Sprintf("0x%x", data)
+	}
+	return fmt.Sprintf("0x%x...(%d bytes)", data[:TRACE_TEXT_MAX_BYTES], len(data))
+}
@@ -0,0 +1,111 @@
+package trace
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// Call is a single call frame of the simulated transaction along with the
+// frames it entered
+type Call struct {
+	Type    vm.OpCode
+	From    common.Address
+	To      common.Address
+	Value   *big.Int
+	Input   []byte
+	Output  []byte
+	Gas     uint64
+	GasUsed uint64
+	Error   error
+	// Reverted is set when the frame's state changes were rolled back
+	Reverted bool
+	Calls    []*Call
+}
+
+// CallTracer builds the call tree of a transaction from the EVM's enter and
+// exit hooks
+type CallTracer struct {
+	root  *Call
+	stack []*Call
+}
+
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+// Hooks returns the tracing hooks to attach to the EVM
+func (t *CallTracer) Hooks() *tracing.Hooks {
+	return &tracing.Hooks{
+		OnEnter: t.onEnter,
+		OnExit:  t.onExit,
+	}
+}
+
+// Root returns the top-level call, or nil if nothing was executed
+func (t *CallTracer) Root() *Call {
+	return t.root
+}
+
+func (t *CallTracer) onEnter(depth int, typ byte, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	call := &Call{
+		Type:  vm.OpCode(typ),
+		From:  from,
+		To:    to,
+		Input: common.CopyBytes(input),
+		Gas:   gas,
+	}
+	if value != nil {
+		call.Value = new(big.Int).Set(value)
+	}
+
+	if depth == 0 {
+		t.root = call
+		t.stack = []*Call{call}
+		return
+	}
+
+	if len(t.stack) > 0 {
+		parent := t.stack[len(t.stack)-1]
+		parent.Calls = append(parent.Calls, call)
+	}
+	t.stack = append(t.stack, call)
+}
+
+func (t *CallTracer) onExit(depth int, output []byte, gasUsed uint64, err error, reverted bool) {
+	if len(t.stack) == 0 {
+		return
+	}
+
+	call := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+
+	call.Output = common.CopyBytes(output)
+	call.GasUsed = gasUsed
+	call.Error = err
+	call.Reverted = reverted
+}
+
+// CombineHooks returns hooks that call the enter and exit hooks of each of the
+// given hooks in order. Only OnEnter and OnExit are combined, which are the
+// only hooks used during simulation.
+func CombineHooks(hooks ...*tracing.Hooks) *tracing.Hooks {
+	return &tracing.Hooks{
+		OnEnter: func(depth int, typ byte, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+			for _, h := range hooks {
+				if h != nil && h.OnEnter != nil {
+					h.OnEnter(depth, typ, from, to, input, gas, value)
+				}
+			}
+		},
+		OnExit: func(depth int, output []byte, gasUsed uint64, err error, reverted bool) {
+			for _, h := range hooks {
+				if h != nil && h.OnExit != nil {
+					h.OnExit(depth, output, gasUsed, err, reverted)
+				}
+			}
+		},
+	}
+}
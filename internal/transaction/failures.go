@@ -0,0 +1,136 @@
+package transaction
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jackchuma/state-diff/bindings"
+	"github.com/jackchuma/state-diff/internal/state"
+	"github.com/jackchuma/state-diff/internal/trace"
+)
+
+var EXECUTION_FAILURE_TOPIC = crypto.Keccak256Hash([]byte("ExecutionFailure(bytes32,uint256)"))
+var MODULE_EXECUTION_FAILURE_TOPIC = crypto.Keccak256Hash([]byte("ExecutionFromModuleFailure(address)"))
+var EXEC_TRANSACTION_SELECTOR = crypto.Keccak256([]byte("execTransaction(address,uint256,bytes,uint8,uint256,uint256,uint256,address,address,bytes)"))[:4]
+
+// InnerFailureError reports a call inside the simulated transaction that failed
+// without reverting the transaction as a whole
+type InnerFailureError struct {
+	Address common.Address
+	Reason  string
+}
+
+func (e *InnerFailureError) Error() string {
+	return fmt.Sprintf("inner execution failed at %s: %s", e.Address.Hex(), e.Reason)
+}
+
+// checkInnerFailures inspects the call frames, the return data of the
+// top-level call and the emitted logs for Safe executions and Multicall3
+// sub-calls that failed silently
+func checkInnerFailures(to common.Address, data, ret []byte, logs []state.Log, root *trace.Call) error {
+	var failures []error
+
+	for _, log := range logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+
+		switch log.Topics[0] {
+		case EXECUTION_FAILURE_TOPIC:
+			failures = append(failures, &InnerFailureError{
+				Address: log.Address,
+				Reason:  "Safe emitted ExecutionFailure, the inner Safe transaction did not succeed",
+			})
+		case MODULE_EXECUTION_FAILURE_TOPIC:
+			failures = append(failures, &InnerFailureError{
+				Address: log.Address,
+				Reason:  "Safe emitted ExecutionFromModuleFailure, the module transaction did not succeed",
+			})
+		}
+	}
+
+	if root != nil {
+		multicallABI, err := abi.JSON(strings.NewReader(bindings.Multicall3ABI))
+		if err != nil {
+			return fmt.Errorf("failed to parse Multicall3 ABI: %w", err)
+		}
+		failures = append(failures, checkMulticallFrames(&multicallABI, root)...)
+	}
+
+	if len(data) >= 4 && bytes.Equal(data[:4], EXEC_TRANSACTION_SELECTOR) {
+		if err := checkExecTransactionResult(to, ret); err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	return errors.Join(failures...)
+}
+
+// checkMulticallFrames reports every reverted sub-call of a Multicall3 frame
+// that did not revert itself, wherever it sits in the call tree. A Multicall3
+// that is delegatecalled, e.g. by a Safe, runs in the caller's context, which
+// is the address reported. Frames that reverted are skipped along with their
+// sub-calls since their failures surface through the frame that reverted.
+func checkMulticallFrames(multicallABI *abi.ABI, call *trace.Call) []error {
+	if call.Reverted {
+		return nil
+	}
+
+	var failures []error
+	if call.To == MULTICALL3_ADDRESS {
+		context := call.To
+		if call.Type == vm.DELEGATECALL {
+			context = call.From
+		}
+
+		function := "call"
+		if len(call.Input) >= 4 {
+			if method, err := multicallABI.MethodById(call.Input[:4]); err == nil {
+				function = method.Name
+			}
+		}
+
+		for i, sub := range call.Calls {
+			if !sub.Reverted {
+				continue
+			}
+
+			var reason error = DecodeRevert(sub.Output)
+			if sub.Error != nil && !errors.Is(sub.Error, vm.ErrExecutionReverted) {
+				reason = sub.Error
+			}
+			failures = append(failures, &InnerFailureError{
+				Address: context,
+				Reason:  fmt.Sprintf("Multicall3 %s sub-call %d to %s failed: %s", function, i, sub.To.Hex(), reason),
+			})
+		}
+	}
+
+	for _, sub := range call.Calls {
+		failures = append(failures, checkMulticallFrames(multicallABI, sub)...)
+	}
+
+	return failures
+}
+
+// checkExecTransactionResult reports a Safe execTransaction that returned false
+func checkExecTransactionResult(to common.Address, ret []byte) error {
+	if len(ret) != 32 {
+		return nil
+	}
+
+	if common.BytesToHash(ret) == (common.Hash{}) {
+		return &InnerFailureError{
+			Address: to,
+			Reason:  "Safe execTransaction returned false",
+		}
+	}
+
+	return nil
+}
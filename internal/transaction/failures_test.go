@@ -0,0 +1,170 @@
+package transaction
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/jackchuma/state-diff/bindings"
+	"github.com/jackchuma/state-diff/internal/trace"
+)
+
+var (
+	safeAddress = common.HexToAddress("0x000000000000000000000000000000000000005a")
+	sender      = common.HexToAddress("0x0000000000000000000000000000000000000001")
+	targetA     = common.HexToAddress("0x000000000000000000000000000000000000000a")
+	targetB     = common.HexToAddress("0x000000000000000000000000000000000000000b")
+)
+
+// frame is a call to replay through the tracer hooks
+type frame struct {
+	typ      vm.OpCode
+	from     common.Address
+	to       common.Address
+	input    []byte
+	output   []byte
+	reverted bool
+	calls    []frame
+}
+
+// replay feeds the frame and its sub-calls to the tracer the way the EVM does
+func replay(t *trace.CallTracer, depth int, f frame) {
+	hooks := t.Hooks()
+	hooks.OnEnter(depth, byte(f.typ), f.from, f.to, f.input, 100000, big.NewInt(0))
+	for _, sub := range f.calls {
+		replay(t, depth+1, sub)
+	}
+
+	var err error
+	if f.reverted {
+		err = vm.ErrExecutionReverted
+	}
+	hooks.OnExit(depth, f.output, 1000, err, f.reverted)
+}
+
+func revertData(t *testing.T, reason string) []byte {
+	t.Helper()
+
+	stringType, err := abi.NewType("string", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := abi.Arguments{{Type: stringType}}.Pack(reason)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(common.CopyBytes(ERROR_SELECTOR), encoded...)
+}
+
+func TestCheckInnerFailures(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(bindings.Multicall3ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := []bindings.Multicall3Call3{
+		{Target: targetA, AllowFailure: true, CallData: []byte{0x01}},
+		{Target: targetB, AllowFailure: true, CallData: []byte{0x02}},
+	}
+	aggregate3, err := parsed.Pack("aggregate3", calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// subCalls returns the frames of the two sub-calls made from context, the
+	// second of which reverts
+	subCalls := func(context common.Address) []frame {
+		return []frame{
+			{typ: vm.CALL, from: context, to: targetA, input: []byte{0x01}},
+			{typ: vm.CALL, from: context, to: targetB, input: []byte{0x02}, output: revertData(t, "not allowed"), reverted: true},
+		}
+	}
+	execTransaction := append(common.CopyBytes(EXEC_TRANSACTION_SELECTOR), make([]byte, 32)...)
+	success := common.BigToHash(big.NewInt(1)).Bytes()
+
+	tests := []struct {
+		name    string
+		to      common.Address
+		data    []byte
+		ret     []byte
+		root    frame
+		address common.Address
+		reason  string
+	}{
+		{
+			name: "Safe delegatecalls Multicall3",
+			to:   safeAddress,
+			data: execTransaction,
+			ret:  success,
+			root: frame{typ: vm.CALL, from: sender, to: safeAddress, input: execTransaction, output: success, calls: []frame{
+				{typ: vm.DELEGATECALL, from: safeAddress, to: MULTICALL3_ADDRESS, input: aggregate3, calls: subCalls(safeAddress)},
+			}},
+			address: safeAddress,
+			reason:  `Multicall3 aggregate3 sub-call 1 to ` + targetB.Hex() + ` failed: execution reverted: "not allowed"`,
+		},
+		{
+			name:    "Multicall3 called directly",
+			to:      MULTICALL3_ADDRESS,
+			data:    aggregate3,
+			root:    frame{typ: vm.CALL, from: sender, to: MULTICALL3_ADDRESS, input: aggregate3, calls: subCalls(MULTICALL3_ADDRESS)},
+			address: MULTICALL3_ADDRESS,
+			reason:  "Multicall3 aggregate3 sub-call 1 to " + targetB.Hex() + " failed",
+		},
+		{
+			name: "Multicall3 nested in a Safe call",
+			to:   safeAddress,
+			data: execTransaction,
+			ret:  success,
+			root: frame{typ: vm.CALL, from: sender, to: safeAddress, input: execTransaction, output: success, calls: []frame{
+				{typ: vm.CALL, from: safeAddress, to: MULTICALL3_ADDRESS, input: aggregate3, calls: subCalls(MULTICALL3_ADDRESS)},
+			}},
+			address: MULTICALL3_ADDRESS,
+			reason:  "Multicall3 aggregate3 sub-call 1 to " + targetB.Hex() + " failed",
+		},
+		{
+			name: "reverted Multicall3",
+			to:   safeAddress,
+			data: execTransaction,
+			ret:  success,
+			root: frame{typ: vm.CALL, from: sender, to: safeAddress, input: execTransaction, output: success, calls: []frame{
+				{typ: vm.DELEGATECALL, from: safeAddress, to: MULTICALL3_ADDRESS, input: aggregate3, reverted: true, calls: subCalls(safeAddress)},
+			}},
+		},
+		{
+			name: "reverted call outside Multicall3",
+			to:   safeAddress,
+			data: execTransaction,
+			ret:  success,
+			root: frame{typ: vm.CALL, from: sender, to: safeAddress, input: execTransaction, output: success, calls: subCalls(safeAddress)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracer := trace.NewCallTracer()
+			replay(tracer, 0, test.root)
+
+			err := checkInnerFailures(test.to, test.data, test.ret, nil, tracer.Root())
+			if test.reason == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var failure *InnerFailureError
+			if !errors.As(err, &failure) {
+				t.Fatalf("error = %v, want an inner failure", err)
+			}
+			if failure.Address != test.address {
+				t.Errorf("failure at %s, want %s", failure.Address.Hex(), test.address.Hex())
+			}
+			if !strings.HasPrefix(failure.Reason, test.reason) {
+				t.Errorf("reason = %q, want prefix %q", failure.Reason, test.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var ERROR_SELECTOR = crypto.Keccak256([]byte("Error(string)"))[:4]
+var PANIC_SELECTOR = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+
+// RevertKind tells apart the ways revert data can be decoded
+type RevertKind string
+
+const (
+	RevertEmpty   RevertKind = "empty"
+	RevertString  RevertKind = "error"
+	RevertSafe    RevertKind = "safe"
+	RevertPanic   RevertKind = "panic"
+	RevertCustom  RevertKind = "custom"
+	RevertUnknown RevertKind = "unknown"
+)
+
+// RevertError is returned when the simulated transaction reverts. Reason holds
+// the decoded message: the Error(string) message, the meaning of a Safe GSxxx
+// code or Solidity panic code, or the decoded custom error.
+type RevertError struct {
+	Kind   RevertKind
+	Reason string
+	// Code is the Safe error code (e.g. GS013) or the panic code in hex
+	Code string
+	Data []byte
+}
+
+func (e *RevertError) Error() string {
+	switch e.Kind {
+	case RevertEmpty:
+		return "execution reverted without a reason"
+	case RevertString:
+		return fmt.Sprintf("execution reverted: %q", e.Reason)
+	case RevertSafe:
+		return fmt.Sprintf("execution reverted: Safe error %s (%s)", e.Code, e.Reason)
+	case RevertPanic:
+		return fmt.Sprintf("execution reverted: Panic(%s): %s", e.Code, e.Reason)
+	case RevertCustom:
+		return fmt.Sprintf("execution reverted: %s", e.Reason)
+	}
+	return fmt.Sprintf("execution reverted with undecoded data 0x%x", e.Data)
+}
+
+func (e *RevertError) Unwrap() error {
+	return vm.ErrExecutionReverted
+}
+
+// Safe error codes, from Safe's docs/error_codes.md
+var SAFE_ERROR_CODES = map[string]string{
+	"GS000": "Could not finish initialization",
+	"GS001": "Threshold needs to be defined",
+	"GS010": "Not enough gas to execute Safe transaction",
+	"GS011": "Could not pay gas costs with ether",
+	"GS012": "Could not pay gas costs with token",
+	"GS013": "Safe transaction failed when gasPrice and safeTxGas were 0",
+	"GS020": "Signatures data too short",
+	"GS021": "Invalid contract signature location: inside static part",
+	"GS022": "Invalid contract signature location: length not present",
+	"GS023": "Invalid contract signature location: data not complete",
+	"GS024": "Invalid contract signature provided",
+	"GS025": "Hash has not been approved",
+	"GS026": "Invalid owner provided",
+	"GS030": "Only owners can approve a hash",
+	"GS031": "Method can only be called from this contract",
+	"GS100": "Modules have already been initialized",
+	"GS101": "Invalid module address provided",
+	"GS102": "Module has already been added",
+	"GS103": "Invalid prevModule, module pair provided",
+	"GS104": "Method can only be called from an enabled module",
+	"GS105": "Invalid starting point for fetching paginated modules",
+	"GS106": "Invalid page size for fetching paginated modules",
+	"GS200": "Owners have already been setup",
+	"GS201": "Threshold cannot exceed owner count",
+	"GS202": "Threshold needs to be greater than 0",
+	"GS203": "Invalid owner address provided",
+	"GS204": "Address is already an owner",
+	"GS205": "Invalid prevOwner, owner pair provided",
+	"GS300": "Guard does not implement IERC165",
+	"GS400": "Fallback handler cannot be set to self",
+}
+
+// Solidity panic codes, from the Solidity docs on Panic(uint256)
+var PANIC_CODES = map[uint64]string{
+	0x00: "generic compiler inserted panic",
+	0x01: "assertion failed",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "invalid enum value",
+	0x22: "incorrectly encoded storage byte array",
+	0x31: "pop on an empty array",
+	0x32: "array index out of bounds",
+	0x41: "too much memory allocated",
+	0x51: "call to a zero-initialized internal function",
+}
+
+var safeErrorCodePattern = regexp.MustCompile(`^GS\d{3}$`)
+
+// customErrors holds the custom errors loaded from artifacts, by selector
+var customErrors = make(map[[4]byte]abi.Error)
+
+// DecodeRevert decodes revert data into a RevertError
+func DecodeRevert(data []byte) *RevertError {
+	result := &RevertError{Kind: RevertUnknown, Data: data}
+	if len(data) == 0 {
+		result.Kind = RevertEmpty
+		return result
+	}
+	if len(data) < 4 {
+		return result
+	}
+
+	switch {
+	case bytes.Equal(data[:4], ERROR_SELECTOR):
+		reason, err := abi.UnpackRevert(data)
+		if err != nil {
+			return result
+		}
+		result.Kind = RevertString
+		result.Reason = reason
+
+		// Safe reverts with short error codes instead of messages
+		if safeErrorCodePattern.MatchString(reason) {
+			result.Kind = RevertSafe
+			result.Code = reason
+			result.Reason = SAFE_ERROR_CODES[reason]
+			if result.Reason == "" {
+				result.Reason = "unknown Safe error code"
+			}
+		}
+	case bytes.Equal(data[:4], PANIC_SELECTOR):
+		if len(data) != 36 {
+			return result
+		}
+		code := new(big.Int).SetBytes(data[4:])
+		result.Kind = RevertPanic
+		result.Code = fmt.Sprintf("0x%x", code)
+		result.Reason = "unknown panic code"
+		if code.IsUint64() {
+			if meaning, ok := PANIC_CODES[code.Uint64()]; ok {
+				result.Reason = meaning
+			}
+		}
+	default:
+		customError, ok := customErrors[[4]byte(data[:4])]
+		if !ok {
+			return result
+		}
+		values, err := customError.Unpack(data)
+		if err != nil {
+			return result
+		}
+		result.Kind = RevertCustom
+		result.Reason = formatCustomError(customError, values)
+	}
+
+	return result
+}
+
+func formatCustomError(customError abi.Error, values any) string {
+	unpacked, ok := values.([]any)
+	if !ok {
+		return customError.Sig
+	}
+
+	args := make([]string, len(customError.Inputs))
+	for i, input := range customError.Inputs {
+		value := "?"
+		if i < len(unpacked) {
+			value = fmt.Sprintf("%v", unpacked[i])
+		}
+		if input.Name != "" {
+			args[i] = fmt.Sprintf("%s: %s", input.Name, value)
+		} else {
+			args[i] = value
+		}
+	}
+	return fmt.Sprintf("%s(%s)", customError.Name, strings.Join(args, ", "))
+}
+
+// LoadArtifacts reads the custom errors of every contract ABI in a directory of
+// compiler artifacts (Foundry's out/ or Hardhat's artifacts/) so reverts can be
+// decoded, returning the number of errors loaded. Files that aren't artifacts
+// are skipped.
+func LoadArtifacts(dir string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Build info files hold full compiler inputs and outputs, not ABIs
+		if entry.IsDir() && entry.Name() == "build-info" {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		parsed, ok := readArtifactABI(path)
+		if !ok {
+			return nil
+		}
+		for _, customError := range parsed.Errors {
+			selector := [4]byte(customError.ID[:4])
+			if _, ok := customErrors[selector]; !ok {
+				customErrors[selector] = customError
+				count++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("error loading artifacts from %s: %w", dir, err)
+	}
+	return count, nil
+}
+
+// readArtifactABI parses the ABI of an artifact file, which is either an
+// object with an "abi" field or a bare ABI array
+func readArtifactABI(path string) (*abi.ABI, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var artifact struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if err := json.Unmarshal(data, &artifact); err == nil && artifact.ABI != nil {
+		data = artifact.ABI
+	}
+
+	parsed, err := abi.JSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	return &parsed, true
+}
@@ -1,26 +1,32 @@
 package transaction
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"net/url"
-	"reflect"
-	"strings"
+	"os"
 
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/holiman/uint256"
-	"github.com/jackchuma/state-diff/bindings"
+	"github.com/jackchuma/state-diff/internal/calldata"
+	"github.com/jackchuma/state-diff/internal/chain"
 	"github.com/jackchuma/state-diff/internal/state"
+	"github.com/jackchuma/state-diff/internal/trace"
 )
 
 var VALUE = big.NewInt(0)
 var GAS = uint64(8000000)
+var MULTICALL3_ADDRESS = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
 
-func CreateTransaction(client *ethclient.Client, chainID *big.Int, m url.Values) (*types.Transaction, error) {
+func CreateTransaction(chainID *big.Int, m url.Values) (*types.Transaction, error) {
 	recipient := common.HexToAddress(m["contractAddress"][0])
 	value := VALUE
 	data := common.FromHex(m["rawFunctionInput"][0])
@@ -39,84 +45,145 @@ func CreateTransaction(client *ethclient.Client, chainID *big.Int, m url.Values)
 	return types.NewTx(&txData), nil
 }
 
-// SimulateTransaction simulates a transaction and returns the state diff
-func SimulateTransaction(evm *vm.EVM, tx *types.Transaction, from common.Address) ([]state.StateDiff, error) {
+// SimulateTransaction simulates a transaction and returns the state diff along
+// with the gas used, computed the same way as a transaction receipt
+func SimulateTransaction(evm *vm.EVM, tx *types.Transaction, from common.Address) ([]state.StateDiff, uint64, error) {
 	statedb := evm.StateDB
 	to := *tx.To()
 
 	value := new(uint256.Int)
 	value.SetFromBig(tx.Value())
 
-	ret, gasUsed, err := evm.Call(from, to, tx.Data(), tx.Gas(), value)
+	rules := evm.ChainConfig().Rules(evm.Context.BlockNumber, evm.Context.Random != nil, evm.Context.Time)
+
+	intrinsicGas, err := core.IntrinsicGas(tx.Data(), tx.AccessList(), tx.SetCodeAuthorizations(), false, rules.IsHomestead, rules.IsIstanbul, rules.IsShanghai)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to compute intrinsic gas: %w", err)
+	}
+	if tx.Gas() < intrinsicGas {
+		return nil, 0, fmt.Errorf("gas limit %d below intrinsic gas %d", tx.Gas(), intrinsicGas)
+	}
+
+	// Warm the sender, recipient, precompiles and access list like a real transaction
+	statedb.Prepare(rules, from, evm.Context.Coinbase, &to, chain.ActivePrecompiles(evm.ChainConfig(), rules, evm.Context.Time), tx.AccessList())
+
+	// Record the call frames to find failed Multicall3 sub-calls at any depth
+	callTracer := trace.NewCallTracer()
+	defer func(hooks *tracing.Hooks) { evm.Config.Tracer = hooks }(evm.Config.Tracer)
+	evm.Config.Tracer = trace.CombineHooks(evm.Config.Tracer, callTracer.Hooks())
+
+	ret, leftOverGas, err := evm.Call(from, to, tx.Data(), tx.Gas()-intrinsicGas, value)
+	gasUsed := tx.Gas() - leftOverGas
+
+	cachingDB := statedb.(*state.CachingStateDB)
+
+	// Any state that failed to load or verify can't be relied on, so neither a
+	// revert nor a diff from this simulation can be trusted
+	if fetchErr := cachingDB.Error(); fetchErr != nil {
+		return nil, gasUsed, fmt.Errorf("simulation used state that could not be fetched or verified: %w", fetchErr)
+	}
+
 	if err != nil {
 		if err == vm.ErrExecutionReverted {
-			reason := string(ret)
-			fmt.Printf("EVM Call reverted. Gas used: %d\n", gasUsed)
-			fmt.Printf("Revert reason bytes: %x\n", ret)
-			fmt.Printf("Revert reason: %s\n", reason)
-			return nil, fmt.Errorf("transaction reverted during simulation: %w", err)
+			return nil, gasUsed, fmt.Errorf("transaction reverted during simulation: %w", DecodeRevert(ret))
 		} else {
-			return nil, fmt.Errorf("failed to execute transaction simulation: %w", err)
+			return nil, gasUsed, fmt.Errorf("failed to execute transaction simulation: %w", err)
 		}
 	}
 
-	cachingDB := statedb.(*state.CachingStateDB)
-	return cachingDB.GetStateDiffs(), nil
+	gasUsed, err = applyRefund(rules, statedb, tx, gasUsed)
+	if err != nil {
+		return nil, gasUsed, err
+	}
+
+	// Safe and Multicall3 can swallow a failed inner call without reverting
+	if err := checkInnerFailures(to, tx.Data(), ret, cachingDB.GetLogs(), callTracer.Root()); err != nil {
+		return nil, gasUsed, fmt.Errorf("transaction succeeded but an inner call failed: %w", err)
+	}
+
+	return cachingDB.GetStateDiffs(), gasUsed, nil
 }
 
-func GetTargetedSafe(tx *types.Transaction) (string, error) {
-	multicallAddress := common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+// applyRefund subtracts the capped gas refund from the gas used and applies the
+// EIP-7623 calldata floor, matching core's state transition
+func applyRefund(rules params.Rules, statedb vm.StateDB, tx *types.Transaction, gasUsed uint64) (uint64, error) {
+	refund := gasUsed / params.RefundQuotient
+	if rules.IsLondon {
+		refund = gasUsed / params.RefundQuotientEIP3529
+	}
+	if refund > statedb.GetRefund() {
+		refund = statedb.GetRefund()
+	}
+	gasUsed -= refund
 
-	if *tx.To() == multicallAddress {
-		parsedABI, err := abi.JSON(strings.NewReader(bindings.Multicall3ABI))
+	if rules.IsPrague {
+		floorDataGas, err := core.FloorDataGas(tx.Data())
 		if err != nil {
-			return "", fmt.Errorf("failed to parse Multicall3 ABI: %w", err)
+			return gasUsed, fmt.Errorf("failed to compute floor data gas: %w", err)
 		}
-
-		// Check if the data corresponds to the 'aggregate' function (first 4 bytes)
-		methodID := tx.Data()[:4]
-		method, err := parsedABI.MethodById(methodID)
-		if err != nil {
-			return "", fmt.Errorf("failed to identify method: %w", err)
+		if gasUsed < floorDataGas {
+			gasUsed = floorDataGas
 		}
+	}
 
-		// Unpack the arguments
-		// We expect the input data for aggregate to be: methodID (4 bytes) + encoded arguments
-		argsData := tx.Data()[4:]
+	return gasUsed, nil
+}
 
-		// Unpack using the signature revealed by the linter: returns ([]any, error)
-		unpackedSlice, err := method.Inputs.Unpack(argsData)
-		if err != nil {
-			return "", fmt.Errorf("failed to unpack aggregate arguments using aggregateMethod.Inputs.Unpack: %w", err)
-		}
+// GetTargetedSafe returns the Safe whose signers approve the transaction,
+// decoded from the calldata. Without a Safe call it falls back to the first
+// sub-call of a Multicall3 batch, and then to the recipient.
+func GetTargetedSafe(tx *types.Transaction) (string, error) {
+	call := calldata.Decode(*tx.To(), tx.Value(), tx.Data())
+	if call.Error != nil {
+		return "", fmt.Errorf("failed to decode calldata: %w", call.Error)
+	}
 
-		// The aggregate function has one input: calls []Multicall3Call
-		// So, unpackedSlice should contain one element: the calls array itself.
-		if len(unpackedSlice) != 1 {
-			return "", fmt.Errorf("unexpected number of arguments unpacked: expected 1, got %d", len(unpackedSlice))
-		}
+	if safe, ok := calldata.TargetSafe(call); ok {
+		return safe.String(), nil
+	}
 
-		// The first element should be the []Multicall3Call.
-		// Try asserting directly to the slice of the defined struct type.
-		calls, ok := unpackedSlice[0].([]struct {
-			Target       common.Address "json:\"target\""
-			AllowFailure bool           "json:\"allowFailure\""
-			CallData     []uint8        "json:\"callData\""
-		})
-		if !ok {
-			// If this fails, use reflection to inspect the actual type
-			actualType := reflect.TypeOf(unpackedSlice[0])
-			return "", fmt.Errorf("failed to assert unpacked argument to []Multicall3Call. Actual type: %s", actualType.String())
+	if *tx.To() == MULTICALL3_ADDRESS {
+		if call.Function == "" {
+			return "", fmt.Errorf("failed to identify Multicall3 method with selector 0x%x", call.Selector())
 		}
-
-		if len(calls) == 0 {
+		if len(call.Calls) == 0 {
 			return "", fmt.Errorf("decoded 'calls' array is empty")
 		}
-
-		// Extract the target address from the first call
-		targetAddress := calls[0].Target
-		return targetAddress.String(), nil
+		return call.Calls[0].Target.String(), nil
 	}
 
 	return tx.To().String(), nil
 }
+
+// CreateAccessList asks a stand-in node (e.g. a local fork) for the accounts and
+// slots the transaction touches, so they can be prefetched from the real RPC.
+// The stand-in has none of the state overrides, so a partial list from a
+// reverted execution is still returned.
+func CreateAccessList(rpcURL string, tx *types.Transaction, from common.Address) (types.AccessList, error) {
+	client, err := rpc.Dial(rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to access list node: %w", err)
+	}
+	defer client.Close()
+
+	args := map[string]any{
+		"from":  from,
+		"to":    tx.To(),
+		"data":  hexutil.Bytes(tx.Data()),
+		"gas":   hexutil.Uint64(tx.Gas()),
+		"value": (*hexutil.Big)(tx.Value()),
+	}
+
+	var result struct {
+		AccessList types.AccessList `json:"accessList"`
+		Error      string           `json:"error"`
+	}
+	if err := client.CallContext(context.Background(), &result, "eth_createAccessList", args, "latest"); err != nil {
+		return nil, fmt.Errorf("eth_createAccessList failed: %w", err)
+	}
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "Access list node reported an execution error: %s\n", result.Error)
+	}
+
+	return result.AccessList, nil
+}
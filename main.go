@@ -7,16 +7,26 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math/big"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/jackchuma/state-diff/internal/cache"
+	"github.com/jackchuma/state-diff/internal/calldata"
+	"github.com/jackchuma/state-diff/internal/chain"
 	"github.com/jackchuma/state-diff/internal/command"
 	"github.com/jackchuma/state-diff/internal/evm"
+	"github.com/jackchuma/state-diff/internal/fixture"
+	"github.com/jackchuma/state-diff/internal/safe"
 	"github.com/jackchuma/state-diff/internal/state"
 	"github.com/jackchuma/state-diff/internal/template"
+	"github.com/jackchuma/state-diff/internal/trace"
 	"github.com/jackchuma/state-diff/internal/transaction"
 )
 
@@ -27,6 +37,26 @@ func main() {
 	var rpcURL string
 	var outputFile string
 	var outputFormat string
+	var debug bool
+	var traceCalls bool
+	var cacheDir string
+	var block string
+	var verifyProofs bool
+	var prefetchFile string
+	var accessListRPC string
+	var recordFixture string
+	var replayFixture string
+	var allocFile string
+	var allocChainID int64
+	var chainConfigFile string
+	var blockNumberOverride string
+	var blockTimestampOverride string
+	var blockBaseFeeOverride string
+	var blockGasLimitOverride string
+	var blockCoinbaseOverride string
+	var blockPrevRandaoOverride string
+	var artifactsDir string
+	var autoOverrides bool
 	// New flags for pre-extracted data
 	var useExtractedData bool
 	var signingData string
@@ -42,13 +72,33 @@ func main() {
 	flag.StringVar(&workdir, "workdir", ".", "Directory in which to run the subprocess")
 	flag.StringVar(&rpcURL, "rpc", "", "RPC URL to connect to")
 	flag.StringVar(&outputFile, "o", "", "Output file path")
-	flag.StringVar(&outputFormat, "format", "tool", "Output format: tool (for TypeScript compatibility) or json (base-nested.json format with empty metadata fields)")
+	flag.StringVar(&outputFormat, "format", "tool", "Output format: tool (for TypeScript compatibility), json (base-nested.json format with empty metadata fields) or markdown (validation report for signers)")
+	flag.BoolVar(&debug, "debug", false, "Include a debug section (e.g. transient storage writes) in the output")
+	flag.BoolVar(&traceCalls, "trace", false, "Include the call trace tree in the output and print it as text to stderr")
+	flag.StringVar(&block, "block", "latest", "Block to simulate against: a number, a block hash, or latest/safe/finalized")
+	flag.BoolVar(&verifyProofs, "verify-proofs", false, "Verify all fetched state with eth_getProof against the block's state root")
+	flag.StringVar(&prefetchFile, "prefetch-file", "", "Read set file used to prefetch state in batches; updated with this run's reads (optional)")
+	flag.StringVar(&accessListRPC, "access-list-rpc", "", "RPC URL of a local stand-in node used to build a prefetch list with eth_createAccessList (optional)")
+	flag.StringVar(&recordFixture, "record-fixture", "", "Save every RPC response used by the simulation into this fixture bundle file (optional)")
+	flag.StringVar(&replayFixture, "replay-fixture", "", "Simulate offline from a fixture bundle saved with --record-fixture instead of the RPC (optional)")
+	flag.StringVar(&allocFile, "alloc", "", "Simulate fully locally against a genesis alloc file (geth genesis, anvil state dump or bare alloc) instead of the RPC (optional)")
+	flag.Int64Var(&allocChainID, "chain-id", 0, "Chain ID to simulate with when --alloc has no genesis config")
+	flag.StringVar(&chainConfigFile, "chain-config", "", "Genesis JSON file with the chain config to use, for chains without a built-in config (optional)")
+	flag.StringVar(&blockNumberOverride, "block-number", "", "Block number to execute with, absolute or +N relative to the pinned block (optional, state is still read from the pinned block)")
+	flag.StringVar(&blockTimestampOverride, "block-timestamp", "", "Block timestamp to execute with, absolute or +N seconds relative to the pinned block (optional)")
+	flag.StringVar(&blockBaseFeeOverride, "block-basefee", "", "Block base fee in wei to execute with (optional)")
+	flag.StringVar(&blockGasLimitOverride, "block-gas-limit", "", "Block gas limit to execute with (optional)")
+	flag.StringVar(&blockCoinbaseOverride, "block-coinbase", "", "Block coinbase address to execute with (optional)")
+	flag.StringVar(&blockPrevRandaoOverride, "block-prevrandao", "", "Block prevrandao (32 byte hex) to execute with (optional)")
+	flag.StringVar(&artifactsDir, "artifacts", "", "Directory of compiler artifacts (e.g. Foundry's out/) whose ABIs are used to decode custom revert errors (optional)")
+	flag.StringVar(&cacheDir, "cache-dir", "", "Directory for the persistent state cache (optional). Use 'cache inspect' or 'cache clear [--chain ID]' to manage it")
 
 	// New flags for extracted data
 	flag.BoolVar(&useExtractedData, "use-extracted", false, "Use pre-extracted data instead of running script")
 	flag.StringVar(&signingData, "signing-data", "", "EIP-712 signing data (hex string, 66 bytes)")
 	flag.StringVar(&tenderlyLink, "tenderly-link", "", "Tenderly simulation URL (optional, for reference/logging)")
 	flag.StringVar(&stateOverrides, "state-overrides", "", "State overrides JSON (optional)")
+	flag.BoolVar(&autoOverrides, "auto-overrides", false, "Generate the Safe overrides (threshold, owners and approved hashes) the simulation needs from the calldata, on top of any given overrides")
 	flag.StringVar(&rawFunctionInput, "raw-input", "", "Raw function input (optional)")
 	flag.StringVar(&senderAddress, "sender", "", "Sender address for simulation")
 		flag.StringVar(&networkID, "network", "", "Network ID (optional)")
@@ -56,25 +106,115 @@ func main() {
 
 	flag.Parse()
 
-	if rpcURL == "" {
-		fmt.Println("Error: RPC URL is required")
-		os.Exit(1)
+	if flag.NArg() > 0 && flag.Arg(0) == "cache" {
+		if err := runCacheCommand(cacheDir, flag.Args()[1:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Connect to the Ethereum node
-	client, err := ethclient.Dial(rpcURL)
-	if err != nil {
-		fmt.Printf("Failed to connect to the Ethereum client: %v\n", err)
+	if recordFixture != "" && replayFixture != "" {
+		fmt.Println("Error: --record-fixture and --replay-fixture can't be used together")
 		os.Exit(1)
 	}
-
-	// Get chain ID
-	chainID, err := client.ChainID(context.Background())
-	if err != nil {
-		fmt.Printf("Failed to get chain ID: %v\n", err)
+	if allocFile != "" && replayFixture != "" {
+		fmt.Println("Error: --alloc and --replay-fixture can't be used together")
 		os.Exit(1)
 	}
 
+	var source state.StateSource
+	var blockHeader *types.Header
+	var chainID *big.Int
+	var recorder *fixture.Bundle
+	var err error
+
+	if replayFixture != "" {
+		// Everything comes from the bundle, so no RPC is needed
+		replay, err := fixture.Load(replayFixture)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		source = replay
+		blockHeader = replay.Block
+		chainID = replay.ChainID.ToInt()
+		fmt.Fprintf(os.Stderr, "Replaying fixture bundle %s (chain %d, block %d)\n", replayFixture, chainID.Int64(), blockHeader.Number.Int64())
+	} else if allocFile != "" {
+		// Simulate against a local world, so no RPC is needed either
+		source, blockHeader, chainID, err = state.LoadAllocSource(allocFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if allocChainID != 0 {
+			chainID = big.NewInt(allocChainID)
+		}
+	} else {
+		if rpcURL == "" {
+			fmt.Println("Error: RPC URL is required")
+			os.Exit(1)
+		}
+
+		// Connect to the Ethereum node
+		client, err := ethclient.Dial(rpcURL)
+		if err != nil {
+			fmt.Printf("Failed to connect to the Ethereum client: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Get chain ID
+		chainID, err = client.ChainID(context.Background())
+		if err != nil {
+			fmt.Printf("Failed to get chain ID: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Get the header of the pinned block (latest if none was given)
+		blockHeader, err = chain.FetchHeader(client, block)
+		if err != nil {
+			fmt.Printf("Error getting block: %v\n", err)
+			os.Exit(1)
+		}
+		source = state.NewRPCSource(client, blockHeader.Hash())
+	}
+
+	if chainConfigFile != "" {
+		spec, err := chain.LoadChainConfig(chainConfigFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if chainID == nil {
+			chainID = spec.Config.ChainID
+		} else if chainID.Cmp(spec.Config.ChainID) != 0 {
+			fmt.Printf("Error: chain config is for chain %s, but simulating on chain %s\n", spec.Config.ChainID, chainID)
+			os.Exit(1)
+		}
+		chain.Register(spec)
+	}
+
+	if allocFile != "" {
+		if chainID == nil {
+			fmt.Println("Error: --chain-id or --chain-config is required when the alloc file has no genesis config")
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Simulating against alloc file %s (chain %d, block %d)\n", allocFile, chainID.Int64(), blockHeader.Number.Int64())
+	}
+
+	if recordFixture != "" {
+		recorder = fixture.New(chainID)
+	}
+
+	if artifactsDir != "" {
+		count, err := transaction.LoadArtifacts(artifactsDir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Loaded %d custom errors from %s\n", count, artifactsDir)
+	}
+
 	var domainHash []byte
 	var messageHash []byte
 	var finalTenderlyLink string
@@ -136,10 +276,11 @@ func main() {
 		}
 	}
 
-	tx, err := transaction.CreateTransaction(client, chainID, m)
+	tx, err := transaction.CreateTransaction(chainID, m)
 	if err != nil {
 		log.Fatal("Failed to create transaction", err)
 	}
+	calls := calldata.Decode(*tx.To(), tx.Value(), tx.Data())
 
 	overrides := ""
 	if len(m["stateOverrides"]) > 0 {
@@ -148,7 +289,18 @@ func main() {
 		overrides = stateOverrides
 	}
 
-	evm, err := evm.NewEVM(client, chainID, overrides)
+	blockOverrides, err := parseBlockOverrides(blockHeader, blockNumberOverride, blockTimestampOverride, blockBaseFeeOverride, blockGasLimitOverride, blockCoinbaseOverride, blockPrevRandaoOverride)
+	if err != nil {
+		fmt.Printf("Error parsing block overrides: %v\n", err)
+		os.Exit(1)
+	}
+
+	var callTracer *trace.CallTracer
+	if traceCalls {
+		callTracer = trace.NewCallTracer()
+	}
+
+	evm, err := evm.NewEVM(source, chainID, blockHeader, blockOverrides, overrides, cacheDir, verifyProofs, recorder, callTracer)
 	if err != nil {
 		log.Fatal("Failed to create evm: ", err)
 	}
@@ -158,26 +310,122 @@ func main() {
 		sender = common.HexToAddress(m["from"][0])
 	}
 
+	cachingDB := evm.StateDB.(*state.CachingStateDB)
+
+	// exit closes the state cache before exiting, so that a failed run still
+	// flushes the state it fetched
+	exit := func(code int) {
+		if err := cachingDB.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error closing state cache: %v\n", err)
+		}
+		os.Exit(code)
+	}
+
+	// Speculatively warm the cache with batched requests before simulating
+	prefetchList := tx.AccessList()
+	if prefetchFile != "" {
+		readSet, err := state.LoadReadSet(prefetchFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		prefetchList = append(prefetchList, readSet...)
+	}
+	if accessListRPC != "" {
+		accessList, err := transaction.CreateAccessList(accessListRPC, tx, sender)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		prefetchList = append(prefetchList, accessList...)
+	}
+	if err := cachingDB.Prefetch(prefetchList); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	if autoOverrides {
+		generated, err := safe.GenerateOverrides(cachingDB, chainID, calls, sender)
+		if err != nil {
+			fmt.Printf("Error generating Safe overrides: %v\n", err)
+			exit(1)
+		}
+		if err := cachingDB.AddOverrides(generated); err != nil {
+			fmt.Printf("Error applying generated Safe overrides: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Generated overrides for %d Safes\n", len(generated))
+	}
+
+	fileGenerator, err := template.NewFileGenerator(evm.StateDB.(*state.CachingStateDB), chainID.String())
+	if err != nil {
+		fmt.Printf("Error creating file generator: %v\n", err)
+		exit(1)
+	}
+	fileGenerator.SetBlockOverrides(blockOverrides)
+
 	// Simulate the transaction
-	diffs, err := transaction.SimulateTransaction(evm, tx, sender)
+	diffs, gasUsed, err := transaction.SimulateTransaction(evm, tx, sender)
+	if prefetchFile != "" {
+		if err := state.SaveReadSet(prefetchFile, cachingDB.ReadSet()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	if callTracer != nil {
+		// Print the call tree to stderr, most useful when the simulation failed
+		fmt.Fprintf(os.Stderr, "Call trace:\n%s", fileGenerator.FormatTrace(callTracer.Root()))
+	}
 	if err != nil {
 		fmt.Printf("Error simulating transaction: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Print success message to stderr to keep stdout clean for JSON
-	fmt.Fprintf(os.Stderr, "Transaction simulated successfully on chain %d at block %d\n", chainID.Int64(), evm.Context.BlockNumber.Int64())
+	fmt.Fprintf(os.Stderr, "Transaction simulated successfully on chain %d at block %d (gas used: %d)\n", chainID.Int64(), evm.Context.BlockNumber.Int64(), gasUsed)
 
 	targetSafe, err := transaction.GetTargetedSafe(tx)
 	if err != nil {
 		fmt.Printf("Error getting target safe: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 
-	fileGenerator, err := template.NewFileGenerator(evm.StateDB.(*state.CachingStateDB), chainID.String())
+	// Check the hashes we were told to sign against the simulated transaction
+	hashes, err := safe.VerifyHashes(cachingDB, chainID, calls, domainHash, messageHash)
 	if err != nil {
-		fmt.Printf("Error creating file generator: %v\n", err)
-		os.Exit(1)
+		fmt.Printf("Error verifying signing hashes: %v\n", err)
+		exit(1)
+	}
+	if hashes != nil {
+		fmt.Fprintf(os.Stderr, "Verified domain and message hashes of Safe %s at nonce %s\n", hashes.Safe.Hex(), hashes.Nonce)
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: no Safe execTransaction found in the calldata, domain and message hashes were not verified\n")
+	}
+
+	// Follow nested approvals up to the Safe that executes the task
+	levels, err := safe.NestedLevels(cachingDB, chainID, calls)
+	if err != nil {
+		fmt.Printf("Error computing nested hashes: %v\n", err)
+		exit(1)
+	}
+	if len(levels) > 1 {
+		fmt.Fprintf(os.Stderr, "Nested approval: Safe %s approves hash %s on Safe %s\n", levels[0].Safe.Hex(), levels[1].TxHash.Hex(), levels[1].Safe.Hex())
+		if levels[len(levels)-1].Unverified {
+			fmt.Fprintf(os.Stderr, "Warning: the transaction of Safe %s is not in the calldata, the hash it is approved with was not verified\n", levels[len(levels)-1].Safe.Hex())
+		}
+	}
+	fileGenerator.SetSafeLevels(levels)
+
+	// The hash checks read state after the simulation, such as the nonces of
+	// parent Safes, which can't be trusted if it failed to load either
+	if err := cachingDB.Error(); err != nil {
+		fmt.Printf("Error verifying signing hashes: state could not be fetched or verified: %v\n", err)
+		exit(1)
+	}
+
+	// Every state read is done by now, so the bundle holds all the output needs
+	if recorder != nil {
+		if err := recorder.Save(recordFixture); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Recorded fixture bundle to %s\n", recordFixture)
 	}
 
 	// Generate output based on format
@@ -186,20 +434,27 @@ func main() {
 		jsonResult, err := fileGenerator.BuildValidationJSONForTool(targetSafe, evm.StateDB.(*state.CachingStateDB).GetOverrides(), diffs, domainHash, messageHash)
 		if err != nil {
 			fmt.Printf("Error generating JSON: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
+		if debug {
+			jsonResult.Debug = fileGenerator.BuildDebugInfo()
+		}
+		if callTracer != nil {
+			jsonResult.Trace = fileGenerator.BuildTrace(callTracer.Root())
+		}
+		jsonResult.Calls = fileGenerator.BuildCalls(calls)
 
 		jsonBytes, err := json.MarshalIndent(jsonResult, "", "  ")
 		if err != nil {
 			fmt.Printf("Error marshaling JSON: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		if outputFile != "" {
 			err = os.WriteFile(outputFile, jsonBytes, 0644)
 			if err != nil {
 				fmt.Println("Error writing JSON file:", err)
-				return
+				exit(1)
 			}
 		} else {
 			fmt.Println(string(jsonBytes))
@@ -209,28 +464,146 @@ func main() {
 		jsonResult, err := fileGenerator.BuildValidationJSON("", "", "", "", targetSafe, evm.StateDB.(*state.CachingStateDB).GetOverrides(), diffs, domainHash, messageHash)
 		if err != nil {
 			fmt.Printf("Error generating formatted JSON: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
+		if debug {
+			jsonResult.Debug = fileGenerator.BuildDebugInfo()
+		}
+		if callTracer != nil {
+			jsonResult.Trace = fileGenerator.BuildTrace(callTracer.Root())
+		}
+		jsonResult.Calls = fileGenerator.BuildCalls(calls)
 
 		jsonBytes, err := json.MarshalIndent(jsonResult, "", "  ")
 		if err != nil {
 			fmt.Printf("Error marshaling formatted JSON: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		if outputFile != "" {
 			err = os.WriteFile(outputFile, jsonBytes, 0644)
 			if err != nil {
 				fmt.Println("Error writing formatted JSON file:", err)
-				return
+				exit(1)
 			}
 		} else {
 			fmt.Println(string(jsonBytes))
 		}
+	} else if outputFormat == "markdown" {
+		// Generate a human-readable report for signers
+		report, err := fileGenerator.BuildValidationMarkdown(targetSafe, evm.StateDB.(*state.CachingStateDB).GetOverrides(), diffs, domainHash, messageHash)
+		if err != nil {
+			fmt.Printf("Error generating Markdown: %v\n", err)
+			exit(1)
+		}
+
+		if outputFile != "" {
+			err = os.WriteFile(outputFile, []byte(report), 0644)
+			if err != nil {
+				fmt.Println("Error writing Markdown file:", err)
+				exit(1)
+			}
+		} else {
+			fmt.Print(report)
+		}
 	} else {
-		fmt.Printf("Error: Invalid output format '%s'. Use 'tool' or 'json'\n", outputFormat)
-		os.Exit(1)
+		fmt.Printf("Error: Invalid output format '%s'. Use 'tool', 'json' or 'markdown'\n", outputFormat)
+		exit(1)
+	}
+
+	exit(0)
+}
+
+// runCacheCommand handles the 'cache inspect' and 'cache clear' commands
+func runCacheCommand(cacheDir string, args []string) error {
+	if cacheDir == "" {
+		return fmt.Errorf("--cache-dir is required for cache commands")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("expected 'cache inspect' or 'cache clear'")
+	}
+
+	switch args[0] {
+	case "inspect":
+		return cache.Inspect(cacheDir, os.Stdout)
+	case "clear":
+		clearFlags := flag.NewFlagSet("cache clear", flag.ContinueOnError)
+		chain := clearFlags.String("chain", "", "Only clear the cache for this chain ID (optional)")
+		if err := clearFlags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := cache.Clear(cacheDir, *chain); err != nil {
+			return err
+		}
+		fmt.Printf("Cleared state cache at %s\n", cacheDir)
+		return nil
+	default:
+		return fmt.Errorf("unknown cache command '%s', expected 'inspect' or 'clear'", args[0])
+	}
+}
+
+// parseBlockOverrides builds the block context overrides from the command line
+// flags. Block numbers and timestamps starting with + are relative to the
+// pinned block.
+func parseBlockOverrides(header *types.Header, number, timestamp, baseFee, gasLimit, coinbase, prevRandao string) (*evm.BlockOverrides, error) {
+	overrides := &evm.BlockOverrides{}
+
+	if number != "" {
+		value, err := parseRelative(number, header.Number.Uint64())
+		if err != nil {
+			return nil, fmt.Errorf("invalid block number '%s': %w", number, err)
+		}
+		overrides.Number = new(big.Int).SetUint64(value)
+	}
+	if timestamp != "" {
+		value, err := parseRelative(timestamp, header.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block timestamp '%s': %w", timestamp, err)
+		}
+		overrides.Time = &value
+	}
+	if baseFee != "" {
+		value, ok := new(big.Int).SetString(baseFee, 0)
+		if !ok || value.Sign() < 0 {
+			return nil, fmt.Errorf("invalid block base fee '%s'", baseFee)
+		}
+		overrides.BaseFee = value
+	}
+	if gasLimit != "" {
+		value, err := strconv.ParseUint(gasLimit, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block gas limit '%s': %w", gasLimit, err)
+		}
+		overrides.GasLimit = &value
+	}
+	if coinbase != "" {
+		if !common.IsHexAddress(coinbase) {
+			return nil, fmt.Errorf("invalid block coinbase '%s'", coinbase)
+		}
+		value := common.HexToAddress(coinbase)
+		overrides.Coinbase = &value
+	}
+	if prevRandao != "" {
+		value, err := hexutil.Decode(prevRandao)
+		if err != nil || len(value) != common.HashLength {
+			return nil, fmt.Errorf("invalid block prevrandao '%s': expected 32 bytes of hex", prevRandao)
+		}
+		hash := common.BytesToHash(value)
+		overrides.PrevRandao = &hash
+	}
+
+	return overrides, nil
+}
+
+func parseRelative(value string, base uint64) (uint64, error) {
+	if strings.HasPrefix(value, "+") {
+		offset, err := strconv.ParseUint(value[1:], 0, 64)
+		if err != nil {
+			return 0, err
+		}
+		return base + offset, nil
 	}
+	return strconv.ParseUint(value, 0, 64)
 }
 
 // parseSigningData extracts domain and message hashes from EIP-712 signing data